@@ -2,25 +2,42 @@ package linode
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
 	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
+	"github.com/go-resty/resty/v2"
 	"github.com/linode/linodego"
+	cryptossh "golang.org/x/crypto/ssh"
 	"golang.org/x/oauth2"
+	"gopkg.in/ini.v1"
 )
 
 // Driver is the implementation of BaseDriver interface
@@ -28,28 +45,82 @@ type Driver struct {
 	*drivers.BaseDriver
 	client *linodego.Client
 
+	// ipRefreshed is set once the addresses were read from the API by this
+	// driver process
+	ipRefreshed bool
+
 	APIToken         string
+	APITokenFile     string
+	APIProfile       string
+	EncryptSecrets   bool
+	SecretsKeyFile   string
+	APIURL           string
+	APIVersion       string
 	UserAgentPrefix  string
+	APIRetries       int
+	APITimeout       int
 	IPAddress        string
+	IPv6Address      string
+	UseIPv6          bool
+	RefreshIP        bool
 	PrivateIPAddress string
 	CreatePrivateIP  bool
 	DockerPort       int
 
+	VPCID          int
+	VPCLabel       string
+	VPCSubnetID    int
+	VPCSubnetLabel string
+	VPCIPv4        string
+	VPCNAT1To1     bool
+	VPCIPAddress   string
+
+	VLANLabel       string
+	VLANIPAMAddress string
+	VLANIPAddress   string
+
+	FirewallID          int
+	CreateFirewall      bool
+	FirewallSourceCIDRs string
+
+	PlacementGroupID      int
+	PlacementGroupLabel   string
+	PlacementGroupType    string
+	PlacementGroupPolicy  string
+	CreatePlacementGroup  bool
+	PlacementGroupCreated bool
+
 	InstanceID    int
 	InstanceLabel string
+	LabelConflict string
+	Adopted       bool
+
+	InstanceStatus     string
+	PendingMaintenance []string
 
 	Region          string
 	InstanceType    string
 	RootPassword    string
 	AuthorizedUsers string
+	ProfileSSHKeys  string
+	AuthorizedKeys  []string
 	SSHPort         int
+	SSHKeyType      string
+	SSHKeySource    string
 	InstanceImage   string
 	SwapSize        int
+	WaitTimeout     int
+	KillGracePeriod int
+	KeepOnFailure   bool
+
+	StackScriptID     int
+	StackScriptUser   string
+	StackScriptLabel  string
+	StackScriptData   map[string]string
+	StackScriptFile   string
+	StackScriptPublic string
 
-	StackScriptID    int
-	StackScriptUser  string
-	StackScriptLabel string
-	StackScriptData  map[string]string
+	UserData string
 
 	Tags string
 }
@@ -65,17 +136,74 @@ const (
 	defaultInstanceType  = "g6-standard-4"
 	defaultSwapSize      = 512
 	defaultDockerPort    = 2376
+	defaultWaitTimeout   = 180
+
+	// defaultKillGracePeriod is the number of seconds Kill waits for the
+	// guest to respond to a shutdown before forcing the instance off
+	defaultKillGracePeriod = 30
 
 	defaultContainerLinuxSSHUser = "core"
+
+	labelConflictFail   = "fail"
+	labelConflictSuffix = "suffix"
+	labelMaxLength      = 64
+	labelSuffixAttempts = 5
+
+	sshKeyPushTimeout = 30 * time.Second
+
+	apiVersionV4     = "v4"
+	apiVersionV4Beta = "v4beta"
+
+	defaultAPIRetries   = 10
+	defaultAPITimeout   = 120
+	apiRetryWaitTime    = 1 * time.Second
+	apiRetryMaxWaitTime = 60 * time.Second
+
+	maintenanceCompleted = "completed"
+	maintenanceCanceled  = "canceled"
+
+	sshKeyTypeRSA     = "rsa"
+	sshKeyTypeED25519 = "ed25519"
+	defaultSSHKeyType = sshKeyTypeRSA
+
+	allProfileSSHKeys = "all"
+
+	stackScriptRevNotePrefix  = "sha256:"
+	stackScriptAllImages      = "any/all"
+	stackScriptLabelMaxLength = 128
+
+	imageCapabilityCloudInit = "cloud-init"
+
+	vpcNAT1To1Any = "any"
+
+	resourceLabelPrefix          = "docker-machine-"
+	resourceLabelHashLength      = 8
+	firewallLabelMaxLength       = 32
+	placementGroupLabelMaxLength = 64
+
+	scopeReadOnly  = "read_only"
+	scopeReadWrite = "read_write"
+
+	secretsKeyEnvVar      = "LINODE_SECRETS_KEY"
+	encryptedSecretPrefix = "encrypted:"
+	secretsKeyLength      = 32
+
+	defaultPlacementGroupType   = string(linodego.PlacementGroupTypeAntiAffinityLocal)
+	defaultPlacementGroupPolicy = string(linodego.PlacementGroupPolicyStrict)
 )
 
 // NewDriver creates and returns a new instance of the Linode driver
 func NewDriver(hostName, storePath string) *Driver {
 	return &Driver{
-		InstanceImage: defaultInstanceImage,
-		InstanceType:  defaultInstanceType,
-		Region:        defaultRegion,
-		SwapSize:      defaultSwapSize,
+		InstanceImage:   defaultInstanceImage,
+		InstanceType:    defaultInstanceType,
+		Region:          defaultRegion,
+		SwapSize:        defaultSwapSize,
+		SSHKeyType:      defaultSSHKeyType,
+		WaitTimeout:     defaultWaitTimeout,
+		KillGracePeriod: defaultKillGracePeriod,
+		APIRetries:      defaultAPIRetries,
+		APITimeout:      defaultAPITimeout,
 		BaseDriver: &drivers.BaseDriver{
 			MachineName: hostName,
 			StorePath:   storePath,
@@ -86,7 +214,7 @@ func NewDriver(hostName, storePath string) *Driver {
 // getClient prepares the Linode APIv4 Client
 func (d *Driver) getClient() *linodego.Client {
 	if d.client == nil {
-		tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: d.APIToken})
+		tokenSource := oauth2.ReuseTokenSource(nil, tokenFunc(d.apiToken))
 
 		oauth2Client := &http.Client{
 			Transport: &oauth2.Transport{
@@ -102,11 +230,303 @@ func (d *Driver) getClient() *linodego.Client {
 		}
 
 		client.SetUserAgent(ua)
+		if d.APIURL != "" {
+			client.SetBaseURL(d.APIURL)
+		}
+		if d.APIVersion != "" {
+			client.SetAPIVersion(d.APIVersion)
+		}
+		client.SetRetryCount(d.APIRetries)
+		client.SetRetryWaitTime(apiRetryWaitTime)
+		client.SetRetryMaxWaitTime(apiRetryMaxWaitTime)
+		client.AddRetryCondition(retryTransientError)
 		d.client = &client
 	}
 	return d.client
 }
 
+// parseAPIURL validates APIURL and moves a trailing version, as in
+// https://api.linode.com/v4beta, into APIVersion. Like linodego, a URL
+// without a scheme defaults to https.
+func (d *Driver) parseAPIURL() error {
+	if !strings.Contains(d.APIURL, "://") {
+		d.APIURL = "https://" + d.APIURL
+	}
+
+	u, err := url.Parse(d.APIURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("linode-api-url must be an absolute URL: %q", d.APIURL)
+	}
+
+	base, version := path.Split(strings.TrimSuffix(u.Path, "/"))
+	if version == apiVersionV4 || version == apiVersionV4Beta {
+		if d.APIVersion != "" && d.APIVersion != version {
+			return fmt.Errorf("linode-api-url version %s conflicts with linode-api-version %s", version, d.APIVersion)
+		}
+
+		d.APIVersion = version
+		u.Path = strings.TrimSuffix(base, "/")
+	}
+
+	d.APIURL = u.String()
+	return nil
+}
+
+// interruptContext is cancelled when the driver process is interrupted, which
+// abandons in-flight API requests and waits. A second interrupt terminates
+// the process as usual.
+var interruptContext = sync.OnceValue(func() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return ctx
+})
+
+// apiContext returns the context of an API operation, which is cancelled
+// after APITimeout seconds or when the driver process is interrupted
+func (d *Driver) apiContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(interruptContext(), time.Duration(d.getAPITimeout())*time.Second)
+}
+
+// apiToken returns the API token, reading it from APITokenFile or the
+// APIProfile linode-cli configuration when one is set
+func (d *Driver) apiToken() (string, error) {
+	switch {
+	case d.APITokenFile != "":
+		b, err := os.ReadFile(d.APITokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read linode-token-file: %s", err)
+		}
+
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return "", fmt.Errorf("linode-token-file %s is empty", d.APITokenFile)
+		}
+		return token, nil
+	case d.APIProfile != "":
+		return profileToken(d.APIProfile)
+	}
+
+	return d.APIToken, nil
+}
+
+// profileToken reads the token of a linode-cli configuration profile from the
+// files used by linodego's config loader. Values missing from the profile
+// are inherited from the default profile.
+func profileToken(profile string) (string, error) {
+	var path string
+	for _, p := range linodego.DefaultConfigPaths {
+		p, err := linodego.FormatConfigPath(p)
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := os.Stat(p); err == nil {
+			path = p
+			break
+		}
+	}
+
+	if path == "" {
+		return "", fmt.Errorf("linode-cli configuration not found in ~/.config/linode or ~/.config/linode-cli")
+	}
+
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read linode-cli configuration %s: %s", path, err)
+	}
+
+	var config linodego.ConfigProfile
+	if cfg.HasSection(linodego.DefaultConfigProfile) {
+		if err := cfg.Section(linodego.DefaultConfigProfile).MapTo(&config); err != nil {
+			return "", err
+		}
+	}
+
+	var section *ini.Section
+	for _, s := range cfg.Sections() {
+		if strings.EqualFold(s.Name(), profile) {
+			section = s
+		}
+	}
+
+	if section == nil {
+		return "", fmt.Errorf("linode-cli profile %q not found in %s", profile, path)
+	}
+
+	if err := section.MapTo(&config); err != nil {
+		return "", err
+	}
+
+	if config.APIToken == "" {
+		return "", fmt.Errorf("linode-cli profile %q has no token", profile)
+	}
+
+	return config.APIToken, nil
+}
+
+// MarshalJSON stores the driver, encrypting APIToken and RootPassword when
+// EncryptSecrets is set. Other fields are left readable for inspection.
+func (d *Driver) MarshalJSON() ([]byte, error) {
+	type driver Driver
+	stored := *d
+
+	if d.EncryptSecrets {
+		key, err := d.secretsKey()
+		if err != nil {
+			return nil, err
+		}
+
+		if stored.APIToken, err = encryptSecret(key, d.APIToken); err != nil {
+			return nil, err
+		}
+		if stored.RootPassword, err = encryptSecret(key, d.RootPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal((*driver)(&stored))
+}
+
+// UnmarshalJSON loads the driver, decrypting APIToken and RootPassword when
+// EncryptSecrets is set
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	type driver Driver
+
+	// machines stored before linode-api-retries existed have no APIRetries
+	d.APIRetries = -1
+	if err := json.Unmarshal(data, (*driver)(d)); err != nil {
+		return err
+	}
+	if d.APIRetries < 0 {
+		d.APIRetries = defaultAPIRetries
+	}
+
+	if !d.EncryptSecrets {
+		return nil
+	}
+
+	key, err := d.secretsKey()
+	if err != nil {
+		return err
+	}
+
+	if d.APIToken, err = decryptSecret(key, d.APIToken); err != nil {
+		return fmt.Errorf("failed to decrypt the Linode API Token: %s", err)
+	}
+	if d.RootPassword, err = decryptSecret(key, d.RootPassword); err != nil {
+		return fmt.Errorf("failed to decrypt the Linode root password: %s", err)
+	}
+
+	return nil
+}
+
+// secretsKey returns the base64 encoded, 32 byte AES-256 key in
+// LINODE_SECRETS_KEY, or in SecretsKeyFile when it is set. Passphrases are
+// rejected, as an unsalted key derived from one could be brute-forced from a
+// copy of the machine's config.json.
+func (d *Driver) secretsKey() ([]byte, error) {
+	secret := os.Getenv(secretsKeyEnvVar)
+	if d.SecretsKeyFile != "" {
+		b, err := os.ReadFile(d.SecretsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read linode-secrets-key-file: %s", err)
+		}
+		secret = string(b)
+	}
+
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return nil, fmt.Errorf("linode-encrypt-secrets requires a key in %s or linode-secrets-key-file", secretsKeyEnvVar)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(key) != secretsKeyLength {
+		return nil, fmt.Errorf("the linode-encrypt-secrets key must be %d random bytes, base64 encoded, e.g. from `openssl rand -base64 %d`",
+			secretsKeyLength, secretsKeyLength)
+	}
+
+	return key, nil
+}
+
+// encryptSecret seals a secret with AES-GCM, returning it base64 encoded
+// with encryptedSecretPrefix
+func encryptSecret(key []byte, secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret opens a secret sealed by encryptSecret
+func decryptSecret(key []byte, secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+
+	if !strings.HasPrefix(secret, encryptedSecretPrefix) {
+		return "", errors.New("value is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, encryptedSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is truncated")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("wrong key or corrupted value")
+	}
+
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// tokenFunc is an oauth2.TokenSource for tokens which do not expire
+type tokenFunc func() (string, error)
+
+// Token implements oauth2.TokenSource
+func (f tokenFunc) Token() (*oauth2.Token, error) {
+	token, err := f()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Token{AccessToken: token}, nil
+}
+
 // SetClient sets the Linode API client for the driver
 func (d *Driver) SetClient(client *linodego.Client) {
 	d.client = client
@@ -133,9 +553,31 @@ func (d *Driver) GetSSHHostname() (string, error) {
 }
 
 // GetIP returns an IP or hostname that this host is available at
-// e.g. 1.2.3.4 or docker-host-d60b70a14d3a.cloudapp.net
-// Note that currently the IP Address is cached
+// e.g. 1.2.3.4 or docker-host-d60b70a14d3a.cloudapp.net, or the public IPv6
+// address when UseIPv6 is set
+// Note that the IP Address is cached unless RefreshIP is set, in which case
+// it is read from the API once per driver process. GetState also refreshes
+// the cached addresses when they no longer belong to the instance.
 func (d *Driver) GetIP() (string, error) {
+	if d.RefreshIP && d.InstanceID != 0 && !d.ipRefreshed {
+		ctx, cancel := d.apiContext()
+		defer cancel()
+
+		linode, err := d.getClient().GetInstance(ctx, d.InstanceID)
+		if err != nil {
+			return "", err
+		}
+
+		d.refreshIPAddresses(linode)
+	}
+
+	if d.UseIPv6 {
+		if d.IPv6Address == "" {
+			return "", fmt.Errorf("IPv6 address is not set")
+		}
+		return d.IPv6Address, nil
+	}
+
 	if d.IPAddress == "" {
 		return "", fmt.Errorf("IP address is not set")
 	}
@@ -152,6 +594,29 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Linode API Token",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_TOKEN_FILE",
+			Name:   "linode-token-file",
+			Usage:  "File containing the Linode API Token, which is read whenever the driver needs it",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_PROFILE",
+			Name:   "linode-profile",
+			Usage:  "linode-cli configuration profile providing the Linode API Token",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_ENCRYPT_SECRETS",
+			Name:   "linode-encrypt-secrets",
+			Usage:  "Encrypt the API Token and root password stored with the machine, using the key in LINODE_SECRETS_KEY or linode-secrets-key-file",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_SECRETS_KEY_FILE",
+			Name:   "linode-secrets-key-file",
+			Usage:  "File containing the key used by linode-encrypt-secrets",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "LINODE_ROOT_PASSWORD",
 			Name:   "linode-root-pass",
@@ -162,11 +627,32 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "linode-authorized-users",
 			Usage:  "Linode user accounts (separated by commas) whose Linode SSH keys will be permitted root access to the created node",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_AUTHORIZED_KEYS_FROM_PROFILE",
+			Name:   "linode-authorized-keys-from-profile",
+			Usage:  "Labels (separated by commas) of SSH keys on the token owner's Linode profile to permit root access to the created node, or \"all\"",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "LINODE_LABEL",
 			Name:   "linode-label",
 			Usage:  "Linode Instance Label",
 		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_INSTANCE_ID",
+			Name:   "linode-instance-id",
+			Usage:  "ID of an existing Linode Instance to adopt instead of creating one",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_ADOPT",
+			Name:   "linode-adopt",
+			Usage:  "Adopt the existing Linode Instance with the linode-label instead of creating one",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_LABEL_CONFLICT",
+			Name:   "linode-label-conflict",
+			Usage:  "Action when the Linode Instance Label is already in use: fail, or suffix to append a random suffix",
+			Value:  labelConflictFail,
+		},
 		mcnflag.StringFlag{
 			EnvVar: "LINODE_REGION",
 			Name:   "linode-region",
@@ -191,6 +677,18 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Specifies the user as which docker-machine should log in to the Linode instance to install Docker.",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_SSH_KEY_PATH",
+			Name:   "linode-ssh-key-path",
+			Usage:  "Path to an existing SSH private key to use instead of generating one",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_SSH_KEY_TYPE",
+			Name:   "linode-ssh-key-type",
+			Usage:  "Type of the SSH key generated for the instance (rsa, ed25519)",
+			Value:  defaultSSHKeyType,
+		},
 		mcnflag.StringFlag{
 			EnvVar: "LINODE_IMAGE",
 			Name:   "linode-image",
@@ -209,23 +707,177 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Linode Instance Swap Size (MB)",
 			Value:  defaultSwapSize,
 		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_WAIT_TIMEOUT",
+			Name:   "linode-wait-timeout",
+			Usage:  "Number of seconds to wait for the instance to boot or shut down",
+			Value:  defaultWaitTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_KILL_GRACE_PERIOD",
+			Name:   "linode-kill-grace-period",
+			Usage:  "Number of seconds kill waits for the guest to shut down before forcing it off",
+			Value:  defaultKillGracePeriod,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_URL",
+			Name:   "linode-api-url",
+			Usage:  "Base URL of the Linode API, e.g. a proxy or mock server",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_API_VERSION",
+			Name:   "linode-api-version",
+			Usage:  "Linode API version (v4, v4beta)",
+			Value:  "",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_API_RETRIES",
+			Name:   "linode-api-retries",
+			Usage:  "Number of times a Linode API request is retried after a rate limit, server or network error",
+			Value:  defaultAPIRetries,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_API_TIMEOUT",
+			Name:   "linode-api-timeout",
+			Usage:  "Number of seconds to wait for each Linode API operation, including retries",
+			Value:  defaultAPITimeout,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_KEEP_ON_FAILURE",
+			Name:   "linode-keep-on-failure",
+			Usage:  "Keep the instance and related resources when machine creation fails",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "LINODE_STACKSCRIPT",
 			Name:   "linode-stackscript",
 			Usage:  "Specifies the Linode StackScript to use to create the instance",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_STACKSCRIPT_PUBLIC",
+			Name:   "linode-stackscript-public",
+			Usage:  "Limit the username/label StackScript search to public (true) or the account's own (false) StackScripts",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_STACKSCRIPT_FILE",
+			Name:   "linode-stackscript-file",
+			Usage:  "A local script to upload as a private StackScript and use to create the instance",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "LINODE_STACKSCRIPT_DATA",
 			Name:   "linode-stackscript-data",
 			Usage:  "A JSON string specifying data for the selected StackScript",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_USER_DATA",
+			Name:   "linode-user-data",
+			Usage:  "Cloud-init user data passed to the instance through the Linode Metadata service",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_USER_DATA_FILE",
+			Name:   "linode-user-data-file",
+			Usage:  "A file containing cloud-init user data passed to the instance through the Linode Metadata service",
+			Value:  "",
+		},
 		mcnflag.BoolFlag{
 			EnvVar: "LINODE_CREATE_PRIVATE_IP",
 			Name:   "linode-create-private-ip",
 			Usage:  "Create private IP for the instance",
 		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_VPC_SUBNET_ID",
+			Name:   "linode-vpc-subnet-id",
+			Usage:  "ID of the VPC subnet to attach the instance to",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_VPC_LABEL",
+			Name:   "linode-vpc-label",
+			Usage:  "Label of the VPC to attach the instance to, used together with linode-vpc-subnet-label",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_VPC_SUBNET_LABEL",
+			Name:   "linode-vpc-subnet-label",
+			Usage:  "Label of the subnet within linode-vpc-label to attach the instance to",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_VPC_IPV4",
+			Name:   "linode-vpc-ipv4",
+			Usage:  "A fixed IPv4 address to assign the instance within the VPC subnet",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_VPC_NAT_1_1",
+			Name:   "linode-vpc-nat-1-1",
+			Usage:  "Enable 1:1 NAT of the public IPv4 address to the VPC interface",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_VLAN_LABEL",
+			Name:   "linode-vlan-label",
+			Usage:  "Label of the VLAN to attach the instance to",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_VLAN_IPAM_ADDRESS",
+			Name:   "linode-vlan-ipam-address",
+			Usage:  "IPv4 address in CIDR notation to assign the instance on the VLAN (e.g. 10.0.0.1/24)",
+			Value:  "",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "LINODE_FIREWALL_ID",
+			Name:   "linode-firewall-id",
+			Usage:  "ID of an existing Cloud Firewall to attach to the instance",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_CREATE_FIREWALL",
+			Name:   "linode-create-firewall",
+			Usage:  "Create a Cloud Firewall for the instance allowing only SSH and Docker traffic, removed with the machine",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_FIREWALL_SOURCE_CIDRS",
+			Name:   "linode-firewall-source-cidrs",
+			Usage:  "A comma separated list of CIDRs allowed through the created Cloud Firewall (default: any)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_PLACEMENT_GROUP",
+			Name:   "linode-placement-group",
+			Usage:  "ID or label of the placement group to assign the instance to",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_CREATE_PLACEMENT_GROUP",
+			Name:   "linode-create-placement-group",
+			Usage:  "Create the placement group if it does not exist, removing it with the last machine",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_PLACEMENT_GROUP_TYPE",
+			Name:   "linode-placement-group-type",
+			Usage:  "Affinity type of a created placement group (anti_affinity:local)",
+			Value:  defaultPlacementGroupType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "LINODE_PLACEMENT_GROUP_POLICY",
+			Name:   "linode-placement-group-policy",
+			Usage:  "Enforcement policy of a created placement group (strict, flexible)",
+			Value:  defaultPlacementGroupPolicy,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_USE_IPV6",
+			Name:   "linode-use-ipv6",
+			Usage:  "Connect to SSH and Docker over the instance's public IPv6 address instead of IPv4",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "LINODE_REFRESH_IP",
+			Name:   "linode-refresh-ip",
+			Usage:  "Always read the instance IP addresses from the Linode API rather than the cached values",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "LINODE_UA_PREFIX",
 			Name:   "linode-ua-prefix",
@@ -248,14 +900,41 @@ func (d *Driver) GetSSHPort() (int, error) {
 	return d.SSHPort, nil
 }
 
-// GetSSHUsername returns username for use with ssh
-func (d *Driver) GetSSHUsername() string {
-	if d.SSHUser == "" {
-		if strings.Contains(d.InstanceImage, "linode/containerlinux") {
-			d.SSHUser = defaultContainerLinuxSSHUser
-		} else {
-			d.SSHUser = defaultSSHUser
-		}
+// getKillGracePeriod returns the number of seconds Kill waits for a shutdown
+func (d *Driver) getKillGracePeriod() int {
+	if d.KillGracePeriod <= 0 {
+		d.KillGracePeriod = defaultKillGracePeriod
+	}
+
+	return d.KillGracePeriod
+}
+
+// getWaitTimeout returns the number of seconds to wait for instance status changes
+func (d *Driver) getWaitTimeout() int {
+	if d.WaitTimeout <= 0 {
+		d.WaitTimeout = defaultWaitTimeout
+	}
+
+	return d.WaitTimeout
+}
+
+// getAPITimeout returns the number of seconds to wait for an API operation
+func (d *Driver) getAPITimeout() int {
+	if d.APITimeout <= 0 {
+		d.APITimeout = defaultAPITimeout
+	}
+
+	return d.APITimeout
+}
+
+// GetSSHUsername returns username for use with ssh
+func (d *Driver) GetSSHUsername() string {
+	if d.SSHUser == "" {
+		if strings.Contains(d.InstanceImage, "linode/containerlinux") {
+			d.SSHUser = defaultContainerLinuxSSHUser
+		} else {
+			d.SSHUser = defaultSSHUser
+		}
 	}
 
 	return d.SSHUser
@@ -265,27 +944,141 @@ func (d *Driver) GetSSHUsername() string {
 // by RegisterCreateFlags
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.APIToken = flags.String("linode-token")
+	d.APITokenFile = flags.String("linode-token-file")
+	d.APIProfile = flags.String("linode-profile")
+	d.EncryptSecrets = flags.Bool("linode-encrypt-secrets")
+	d.SecretsKeyFile = flags.String("linode-secrets-key-file")
 	d.Region = flags.String("linode-region")
 	d.InstanceType = flags.String("linode-instance-type")
 	d.AuthorizedUsers = flags.String("linode-authorized-users")
+	d.ProfileSSHKeys = flags.String("linode-authorized-keys-from-profile")
 	d.RootPassword = flags.String("linode-root-pass")
 	d.SSHPort = flags.Int("linode-ssh-port")
 	d.SSHUser = flags.String("linode-ssh-user")
+	d.SSHKeySource = flags.String("linode-ssh-key-path")
+	d.SSHKeyType = flags.String("linode-ssh-key-type")
 	d.InstanceImage = flags.String("linode-image")
 	d.InstanceLabel = flags.String("linode-label")
+	d.LabelConflict = flags.String("linode-label-conflict")
+	d.InstanceID = flags.Int("linode-instance-id")
+	d.Adopted = d.InstanceID != 0 || flags.Bool("linode-adopt")
 	d.SwapSize = flags.Int("linode-swap-size")
 	d.DockerPort = flags.Int("linode-docker-port")
+	d.WaitTimeout = flags.Int("linode-wait-timeout")
+	d.KillGracePeriod = flags.Int("linode-kill-grace-period")
+	d.APIURL = flags.String("linode-api-url")
+	d.APIVersion = flags.String("linode-api-version")
+	d.APIRetries = flags.Int("linode-api-retries")
+	d.APITimeout = flags.Int("linode-api-timeout")
+	d.KeepOnFailure = flags.Bool("linode-keep-on-failure")
 	d.CreatePrivateIP = flags.Bool("linode-create-private-ip")
+	d.UseIPv6 = flags.Bool("linode-use-ipv6")
+	d.RefreshIP = flags.Bool("linode-refresh-ip")
+	d.VPCSubnetID = flags.Int("linode-vpc-subnet-id")
+	d.VPCLabel = flags.String("linode-vpc-label")
+	d.VPCSubnetLabel = flags.String("linode-vpc-subnet-label")
+	d.VPCIPv4 = flags.String("linode-vpc-ipv4")
+	d.VPCNAT1To1 = flags.Bool("linode-vpc-nat-1-1")
+	d.VLANLabel = flags.String("linode-vlan-label")
+	d.VLANIPAMAddress = flags.String("linode-vlan-ipam-address")
+	d.FirewallID = flags.Int("linode-firewall-id")
+	d.CreateFirewall = flags.Bool("linode-create-firewall")
+	d.FirewallSourceCIDRs = flags.String("linode-firewall-source-cidrs")
+	d.CreatePlacementGroup = flags.Bool("linode-create-placement-group")
+	d.PlacementGroupType = flags.String("linode-placement-group-type")
+	d.PlacementGroupPolicy = flags.String("linode-placement-group-policy")
 	d.UserAgentPrefix = flags.String("linode-ua-prefix")
 	d.Tags = flags.String("linode-tags")
 
 	d.SetSwarmConfigFromFlags(flags)
 
-	if d.APIToken == "" {
-		return fmt.Errorf("linode driver requires the --linode-token option")
+	if d.APITokenFile != "" && d.APIProfile != "" {
+		return fmt.Errorf("linode-token-file and linode-profile cannot be used together")
+	}
+
+	if d.APITokenFile != "" || d.APIProfile != "" {
+		// Only the reference to the token is stored with the machine
+		d.APIToken = ""
+		if _, err := d.apiToken(); err != nil {
+			return err
+		}
+	} else if d.APIToken == "" {
+		return fmt.Errorf("linode driver requires the --linode-token, --linode-token-file or --linode-profile option")
+	}
+
+	if d.WaitTimeout <= 0 {
+		return fmt.Errorf("linode-wait-timeout must be a positive number of seconds")
+	}
+
+	if d.KillGracePeriod <= 0 {
+		return fmt.Errorf("linode-kill-grace-period must be a positive number of seconds")
+	}
+
+	if d.APIRetries < 0 {
+		return fmt.Errorf("linode-api-retries must not be negative")
+	}
+
+	if d.EncryptSecrets {
+		if _, err := d.secretsKey(); err != nil {
+			return err
+		}
+	} else if d.SecretsKeyFile != "" {
+		return fmt.Errorf("linode-secrets-key-file requires linode-encrypt-secrets")
+	}
+
+	if d.APIURL != "" {
+		if err := d.parseAPIURL(); err != nil {
+			return err
+		}
+	}
+
+	switch d.APIVersion {
+	case "", apiVersionV4, apiVersionV4Beta:
+	default:
+		return fmt.Errorf("unsupported linode-api-version: %q", d.APIVersion)
+	}
+
+	if d.Adopted && d.RootPassword == "" && d.SSHKeySource == "" {
+		return fmt.Errorf("adopting a Linode Instance requires linode-ssh-key-path or linode-root-pass to access it")
+	}
+
+	switch d.LabelConflict {
+	case labelConflictFail, labelConflictSuffix:
+	default:
+		return fmt.Errorf("unsupported linode-label-conflict: %q", d.LabelConflict)
+	}
+
+	switch d.SSHKeyType {
+	case sshKeyTypeRSA, sshKeyTypeED25519:
+	default:
+		return fmt.Errorf("unsupported linode-ssh-key-type: %q", d.SSHKeyType)
+	}
+
+	if d.SSHKeySource != "" {
+		if _, err := readSSHPrivateKey(d.SSHKeySource); err != nil {
+			return err
+		}
 	}
 
 	stackScript := flags.String("linode-stackscript")
+	d.StackScriptFile = flags.String("linode-stackscript-file")
+	d.StackScriptPublic = flags.String("linode-stackscript-public")
+	if stackScript != "" && d.StackScriptFile != "" {
+		return fmt.Errorf("linode-stackscript and linode-stackscript-file cannot be used together")
+	}
+
+	if d.StackScriptPublic != "" {
+		if _, err := strconv.ParseBool(d.StackScriptPublic); err != nil {
+			return fmt.Errorf("linode-stackscript-public must be true or false: %q", d.StackScriptPublic)
+		}
+	}
+
+	if d.StackScriptFile != "" {
+		if _, err := os.Stat(d.StackScriptFile); err != nil {
+			return fmt.Errorf("failed to read linode-stackscript-file: %s", err)
+		}
+	}
+
 	if stackScript != "" {
 		sid, err := strconv.Atoi(stackScript)
 		if err == nil {
@@ -299,7 +1092,9 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 			d.StackScriptUser = ss[0]
 			d.StackScriptLabel = ss[1]
 		}
+	}
 
+	if stackScript != "" || d.StackScriptFile != "" {
 		stackScriptDataStr := flags.String("linode-stackscript-data")
 		if stackScriptDataStr != "" {
 			err := json.Unmarshal([]byte(stackScriptDataStr), &d.StackScriptData)
@@ -309,6 +1104,94 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 		}
 	}
 
+	if d.VPCSubnetID != 0 && (d.VPCLabel != "" || d.VPCSubnetLabel != "") {
+		return fmt.Errorf("linode-vpc-subnet-id cannot be combined with linode-vpc-label or linode-vpc-subnet-label")
+	}
+
+	if (d.VPCLabel == "") != (d.VPCSubnetLabel == "") {
+		return fmt.Errorf("linode-vpc-label and linode-vpc-subnet-label must be specified together")
+	}
+
+	if !d.useVPC() && (d.VPCIPv4 != "" || d.VPCNAT1To1) {
+		return fmt.Errorf("linode-vpc-ipv4 and linode-vpc-nat-1-1 require a VPC subnet")
+	}
+
+	if d.VPCIPv4 != "" {
+		if ip := net.ParseIP(d.VPCIPv4); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("linode-vpc-ipv4 must be a valid IPv4 address: %q", d.VPCIPv4)
+		}
+	}
+
+	if d.VLANIPAMAddress != "" {
+		if d.VLANLabel == "" {
+			return fmt.Errorf("linode-vlan-ipam-address requires linode-vlan-label")
+		}
+
+		ip, _, err := net.ParseCIDR(d.VLANIPAMAddress)
+		if err != nil || ip.To4() == nil {
+			return fmt.Errorf("linode-vlan-ipam-address must be an IPv4 address in CIDR notation: %q", d.VLANIPAMAddress)
+		}
+
+		d.VLANIPAddress = ip.String()
+	}
+
+	if d.FirewallID != 0 && d.CreateFirewall {
+		return fmt.Errorf("linode-firewall-id and linode-create-firewall cannot be used together")
+	}
+
+	if d.FirewallSourceCIDRs != "" {
+		if !d.CreateFirewall {
+			return fmt.Errorf("linode-firewall-source-cidrs requires linode-create-firewall")
+		}
+
+		if _, err := d.firewallAddresses(); err != nil {
+			return err
+		}
+	}
+
+	placementGroup := flags.String("linode-placement-group")
+	if placementGroup != "" {
+		if pgid, err := strconv.Atoi(placementGroup); err == nil {
+			d.PlacementGroupID = pgid
+		} else {
+			d.PlacementGroupLabel = placementGroup
+		}
+	}
+
+	if d.CreatePlacementGroup {
+		if d.PlacementGroupID != 0 {
+			return fmt.Errorf("linode-create-placement-group requires a placement group label, not an identifier")
+		}
+
+		if linodego.PlacementGroupType(d.PlacementGroupType) != linodego.PlacementGroupTypeAntiAffinityLocal {
+			return fmt.Errorf("unsupported linode-placement-group-type: %q", d.PlacementGroupType)
+		}
+
+		switch linodego.PlacementGroupPolicy(d.PlacementGroupPolicy) {
+		case linodego.PlacementGroupPolicyStrict, linodego.PlacementGroupPolicyFlexible:
+		default:
+			return fmt.Errorf("unsupported linode-placement-group-policy: %q", d.PlacementGroupPolicy)
+		}
+	}
+
+	userData := flags.String("linode-user-data")
+	userDataFile := flags.String("linode-user-data-file")
+	if userData != "" && userDataFile != "" {
+		return fmt.Errorf("linode-user-data and linode-user-data-file cannot be used together")
+	}
+
+	if userDataFile != "" {
+		b, err := os.ReadFile(userDataFile)
+		if err != nil {
+			return fmt.Errorf("failed to read linode-user-data-file: %s", err)
+		}
+		userData = string(b)
+	}
+
+	if userData != "" {
+		d.UserData = base64.StdEncoding.EncodeToString([]byte(userData))
+	}
+
 	if len(d.InstanceLabel) == 0 {
 		d.InstanceLabel = d.GetMachineName()
 	}
@@ -325,11 +1208,12 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 
 // PreCreateCheck allows for pre-create operations to make sure a driver is ready for creation
 func (d *Driver) PreCreateCheck() error {
-	// TODO(displague) linode-stackscript-file should be read and uploaded (private), then used for boot.
-	// RevNote could be sha256 of file so the file can be referenced instead of reuploaded.
-
 	client := d.getClient()
 
+	if d.Adopted {
+		return d.findAdoptedInstance()
+	}
+
 	if d.RootPassword == "" {
 		log.Info("Generating a secure disposable linode-root-pass...")
 		var err error
@@ -339,250 +1223,1846 @@ func (d *Driver) PreCreateCheck() error {
 		}
 	}
 
-	if d.StackScriptUser != "" {
-		/* N.B. username isn't on the list of filterable fields, however
-		   adding it doesn't make anything fail, so if it becomes
-		   filterable in future this will become more efficient */
-		options := map[string]string{
-			"username": d.StackScriptUser,
-			"label":    d.StackScriptLabel,
+	if err := d.checkTokenScopes(); err != nil {
+		return err
+	}
+
+	if err := d.checkDeployment(); err != nil {
+		return err
+	}
+
+	if err := d.checkLabel(); err != nil {
+		return err
+	}
+
+	if d.CreateFirewall {
+		if err := d.checkFirewallLabel(); err != nil {
+			return err
 		}
-		b, err := json.Marshal(options)
+	}
+
+	var script *linodego.Stackscript
+	if d.StackScriptFile != "" {
+		var err error
+		script, err = d.uploadStackScriptFile()
 		if err != nil {
 			return err
 		}
-		opts := linodego.NewListOptions(0, string(b))
-		stackscripts, err := client.ListStackscripts(context.TODO(), opts)
+	} else if d.StackScriptUser != "" {
+		var err error
+		script, err = d.findStackScript()
 		if err != nil {
 			return err
 		}
-		var script *linodego.Stackscript
-		for _, s := range stackscripts {
-			if s.Username == d.StackScriptUser {
-				script = &s
-				break
-			}
-		}
-		if script == nil {
-			return fmt.Errorf("StackScript not found: %s/%s", d.StackScriptUser, d.StackScriptLabel)
+	} else if d.StackScriptID != 0 {
+		ctx, cancel := d.apiContext()
+		defer cancel()
+
+		var err error
+		script, err = client.GetStackscript(ctx, d.StackScriptID)
+		if err != nil {
+			return fmt.Errorf("StackScript %d could not be used: %s", d.StackScriptID, err)
 		}
+	}
 
+	if script != nil {
 		d.StackScriptUser = script.Username
 		d.StackScriptLabel = script.Label
 		d.StackScriptID = script.ID
-	} else if d.StackScriptID != 0 {
-		script, err := client.GetStackscript(context.TODO(), d.StackScriptID)
+
+		if err := validateStackScriptData(script, d.StackScriptData, d.InstanceImage); err != nil {
+			return err
+		}
+	}
+
+	if d.ProfileSSHKeys != "" {
+		ctx, cancel := d.apiContext()
+		defer cancel()
+
+		keys, err := client.ListSSHKeys(ctx, nil)
 		if err != nil {
-			return fmt.Errorf("StackScript %d could not be used: %s", d.StackScriptID, err)
+			return fmt.Errorf("failed to list profile SSH keys: %s", err)
 		}
 
-		d.StackScriptUser = script.Username
-		d.StackScriptLabel = script.Label
+		d.AuthorizedKeys, err = selectProfileSSHKeys(keys, strings.Split(d.ProfileSSHKeys, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.VPCLabel != "" {
+		if err := d.resolveVPCSubnet(); err != nil {
+			return err
+		}
+	}
+
+	if d.PlacementGroupID != 0 || d.PlacementGroupLabel != "" || d.CreatePlacementGroup {
+		if err := d.resolvePlacementGroup(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// Create a host using the driver's config
-func (d *Driver) Create() error {
-	log.Info("Creating Linode machine instance...")
+// resolvePlacementGroup finds the placement group identified by
+// PlacementGroupID or PlacementGroupLabel. A missing group is only permitted
+// when it will be created with the instance.
+func (d *Driver) resolvePlacementGroup() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
 
-	if d.SSHPort != defaultSSHPort {
-		log.Infof("Using SSH port %d", d.SSHPort)
+	client := d.getClient()
+
+	if d.PlacementGroupID != 0 {
+		pg, err := client.GetPlacementGroup(ctx, d.PlacementGroupID)
+		if err != nil {
+			return fmt.Errorf("placement group %d could not be used: %s", d.PlacementGroupID, err)
+		}
+
+		return d.usePlacementGroup(pg)
 	}
 
-	publicKey, err := d.createSSHKey()
+	if d.PlacementGroupLabel == "" {
+		d.PlacementGroupLabel = d.resourceLabel(placementGroupLabelMaxLength)
+	}
+
+	b, err := json.Marshal(map[string]string{"label": d.PlacementGroupLabel})
 	if err != nil {
 		return err
 	}
 
-	client := d.getClient()
-	boolBooted := !d.CreatePrivateIP
-
-	// Create a linode
-	createOpts := linodego.InstanceCreateOptions{
-		Region:         d.Region,
-		Type:           d.InstanceType,
-		Label:          d.InstanceLabel,
-		RootPass:       d.RootPassword,
-		AuthorizedKeys: []string{strings.TrimSpace(publicKey)},
-		Image:          d.InstanceImage,
-		SwapSize:       &d.SwapSize,
-		PrivateIP:      d.CreatePrivateIP,
-		Booted:         &boolBooted,
+	pgs, err := client.ListPlacementGroups(ctx, linodego.NewListOptions(0, string(b)))
+	if err != nil {
+		return fmt.Errorf("failed to list placement groups: %s", err)
 	}
 
-	if len(d.AuthorizedUsers) > 0 {
-		createOpts.AuthorizedUsers = strings.Split(d.AuthorizedUsers, ",")
+	for _, pg := range pgs {
+		if pg.Label == d.PlacementGroupLabel {
+			return d.usePlacementGroup(&pg)
+		}
 	}
 
-	if d.Tags != "" {
-		createOpts.Tags = strings.Split(d.Tags, ",")
+	if !d.CreatePlacementGroup {
+		return fmt.Errorf("placement group not found: %s", d.PlacementGroupLabel)
 	}
 
-	if d.StackScriptID != 0 {
-		createOpts.StackScriptID = d.StackScriptID
-		createOpts.StackScriptData = d.StackScriptData
-		log.Infof("Using StackScript %d: %s/%s", d.StackScriptID, d.StackScriptUser, d.StackScriptLabel)
+	return nil
+}
+
+// usePlacementGroup assigns an existing placement group to the driver
+func (d *Driver) usePlacementGroup(pg *linodego.PlacementGroup) error {
+	if pg.Region != d.Region {
+		return fmt.Errorf("placement group %s is in region %s, not %s", pg.Label, pg.Region, d.Region)
 	}
 
-	linode, err := client.CreateInstance(context.TODO(), createOpts)
+	d.PlacementGroupID = pg.ID
+	d.PlacementGroupLabel = pg.Label
+
+	return nil
+}
+
+// createPlacementGroup creates the placement group named by PlacementGroupLabel
+func (d *Driver) createPlacementGroup() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	pg, err := d.getClient().CreatePlacementGroup(ctx, linodego.PlacementGroupCreateOptions{
+		Label:                d.PlacementGroupLabel,
+		Region:               d.Region,
+		PlacementGroupType:   linodego.PlacementGroupType(d.PlacementGroupType),
+		PlacementGroupPolicy: linodego.PlacementGroupPolicy(d.PlacementGroupPolicy),
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create placement group: %s", err)
 	}
 
-	d.InstanceID = linode.ID
-	d.InstanceLabel = linode.Label
+	d.PlacementGroupID = pg.ID
+	d.PlacementGroupLabel = pg.Label
+	d.PlacementGroupCreated = true
+	log.Infof("Created placement group %s (%d)", pg.Label, pg.ID)
 
-	// Don't persist alias region names
-	d.Region = linode.Region
+	return nil
+}
 
-	for _, address := range linode.IPv4 {
-		if private := privateIP(*address); !private {
-			d.IPAddress = address.String()
-		} else if d.CreatePrivateIP {
-			d.PrivateIPAddress = address.String()
-		}
+// stackScriptLabel returns the label of a StackScript uploaded from file,
+// shortening the file name so that the hash suffix fits the label limit
+func stackScriptLabel(file, hash string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	suffix := "-" + hash[:12]
+	if len(name) > stackScriptLabelMaxLength-len(suffix) {
+		name = name[:stackScriptLabelMaxLength-len(suffix)]
 	}
 
-	if d.IPAddress == "" {
-		return errors.New("Linode IP Address is not found")
-	}
+	return name + suffix
+}
 
-	if d.CreatePrivateIP && d.PrivateIPAddress == "" {
-		return errors.New("Linode Private IP Address is not found")
+// resourceLabel returns a label for resources created alongside the instance.
+// Labels longer than maxLength are shortened and end in a hash of the
+// instance label, so that instance labels sharing a long prefix still result
+// in unique resource labels.
+func (d *Driver) resourceLabel(maxLength int) string {
+	label := resourceLabelPrefix + d.InstanceLabel
+	if len(label) <= maxLength {
+		return label
 	}
 
-	log.Debugf("Created Linode Instance %s (%d), IP address %q, Private IP address %q",
-		d.InstanceLabel,
-		d.InstanceID,
-		d.IPAddress,
-		d.PrivateIPAddress,
-	)
+	sum := sha256.Sum256([]byte(d.InstanceLabel))
+	suffix := "-" + hex.EncodeToString(sum[:])[:resourceLabelHashLength]
+
+	return strings.TrimRight(label[:maxLength-len(suffix)], noLabelDuplicates) + suffix
+}
 
+// useVPC reports whether the instance should be attached to a VPC subnet
+func (d *Driver) useVPC() bool {
+	return d.VPCSubnetID != 0 || d.VPCSubnetLabel != ""
+}
+
+// resolveVPCSubnet finds the VPC subnet identified by VPCLabel and VPCSubnetLabel
+func (d *Driver) resolveVPCSubnet() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	b, err := json.Marshal(map[string]string{"label": d.VPCLabel})
 	if err != nil {
 		return err
 	}
 
-	if d.CreatePrivateIP {
-		log.Debugf("Enabling Network Helper for Private IP configuration...")
+	vpcs, err := d.getClient().ListVPCs(ctx, linodego.NewListOptions(0, string(b)))
+	if err != nil {
+		return fmt.Errorf("failed to list VPCs: %s", err)
+	}
 
-		configs, err := client.ListInstanceConfigs(context.TODO(), linode.ID, nil)
-		if err != nil {
-			return err
-		}
-		if len(configs) == 0 {
-			return fmt.Errorf("Linode Config was not found for Linode %d", linode.ID)
+	for _, vpc := range vpcs {
+		if vpc.Label != d.VPCLabel {
+			continue
 		}
-		updateOpts := configs[0].GetUpdateOptions()
-		updateOpts.Helpers.Network = true
-		if _, err := client.UpdateInstanceConfig(context.TODO(), linode.ID, configs[0].ID, updateOpts); err != nil {
-			return err
+
+		if vpc.Region != d.Region {
+			return fmt.Errorf("VPC %s is in region %s, not %s", d.VPCLabel, vpc.Region, d.Region)
 		}
 
-		if err := client.BootInstance(context.TODO(), linode.ID, configs[0].ID); err != nil {
-			return err
+		for _, subnet := range vpc.Subnets {
+			if subnet.Label == d.VPCSubnetLabel {
+				d.VPCID = vpc.ID
+				d.VPCSubnetID = subnet.ID
+				return nil
+			}
 		}
-	}
 
-	log.Info("Waiting for Machine Running...")
-	if _, err := client.WaitForInstanceStatus(context.TODO(), d.InstanceID, linodego.InstanceRunning, 180); err != nil {
-		return fmt.Errorf("wait for machine running failed: %s", err)
+		return fmt.Errorf("VPC subnet not found: %s/%s", d.VPCLabel, d.VPCSubnetLabel)
 	}
 
-	return nil
+	return fmt.Errorf("VPC not found: %s", d.VPCLabel)
 }
 
-// GetURL returns a Docker compatible host URL for connecting to this host
-// e.g. tcp://1.2.3.4:2376
-func (d *Driver) GetURL() (string, error) {
-	ip, err := d.GetIP()
-	if err != nil {
-		return "", err
+// firewallAddresses returns the source addresses allowed through a created firewall
+func (d *Driver) firewallAddresses() (linodego.NetworkAddresses, error) {
+	ipv4 := []string{}
+	ipv6 := []string{}
+
+	if d.FirewallSourceCIDRs == "" {
+		ipv4 = append(ipv4, "0.0.0.0/0")
+		ipv6 = append(ipv6, "::/0")
 	}
-	if ip == "" {
-		return "", nil
+
+	for _, cidr := range strings.Split(d.FirewallSourceCIDRs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return linodego.NetworkAddresses{}, fmt.Errorf("linode-firewall-source-cidrs contains an invalid CIDR %q: %s", cidr, err)
+		}
+
+		if ip.To4() != nil {
+			ipv4 = append(ipv4, cidr)
+		} else {
+			ipv6 = append(ipv6, cidr)
+		}
 	}
 
-	return fmt.Sprintf("tcp://%s:%d", ip, d.DockerPort), nil
+	return linodego.NetworkAddresses{IPv4: &ipv4, IPv6: &ipv6}, nil
 }
 
-// GetState returns the state that the host is in (running, stopped, etc)
+// checkFirewallLabel ensures that the label of the firewall to be created is
+// not used by another firewall, such as one kept by linode-keep-on-failure
+func (d *Driver) checkFirewallLabel() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	label := d.resourceLabel(firewallLabelMaxLength)
+	b, err := json.Marshal(map[string]string{"label": label})
+	if err != nil {
+		return err
+	}
+
+	firewalls, err := d.getClient().ListFirewalls(ctx, linodego.NewListOptions(0, string(b)))
+	if err != nil {
+		return fmt.Errorf("failed to list firewalls: %s", err)
+	}
+
+	for _, firewall := range firewalls {
+		if firewall.Label == label {
+			return fmt.Errorf("firewall %s (%d) already exists, remove it or pass it as linode-firewall-id", label, firewall.ID)
+		}
+	}
+
+	return nil
+}
+
+// createFirewall creates a Cloud Firewall which only accepts inbound SSH and
+// Docker traffic
+func (d *Driver) createFirewall() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	addresses, err := d.firewallAddresses()
+	if err != nil {
+		return err
+	}
+
+	createOpts := linodego.FirewallCreateOptions{
+		Label: d.resourceLabel(firewallLabelMaxLength),
+		Rules: linodego.FirewallRuleSet{
+			Inbound: []linodego.FirewallRule{
+				{
+					Action:    "ACCEPT",
+					Label:     "docker-machine-ssh",
+					Ports:     strconv.Itoa(d.SSHPort),
+					Protocol:  linodego.TCP,
+					Addresses: addresses,
+				},
+				{
+					Action:    "ACCEPT",
+					Label:     "docker-machine-docker",
+					Ports:     strconv.Itoa(d.DockerPort),
+					Protocol:  linodego.TCP,
+					Addresses: addresses,
+				},
+			},
+			InboundPolicy:  "DROP",
+			OutboundPolicy: "ACCEPT",
+		},
+	}
+
+	if d.Tags != "" {
+		createOpts.Tags = strings.Split(d.Tags, ",")
+	}
+
+	firewall, err := d.getClient().CreateFirewall(ctx, createOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create firewall: %s", err)
+	}
+
+	d.FirewallID = firewall.ID
+	log.Infof("Created Cloud Firewall %s (%d)", firewall.Label, firewall.ID)
+
+	return nil
+}
+
+// createInterfaces returns the configuration profile interfaces for a new
+// instance, or nil when the default public interface alone is sufficient
+func (d *Driver) createInterfaces() []linodego.InstanceConfigInterfaceCreateOptions {
+	if !d.useVPC() && d.VLANLabel == "" {
+		return nil
+	}
+
+	interfaces := []linodego.InstanceConfigInterfaceCreateOptions{
+		{Purpose: linodego.InterfacePurposePublic},
+	}
+
+	if d.useVPC() {
+		interfaces = append(interfaces, d.vpcInterface())
+	}
+
+	if d.VLANLabel != "" {
+		interfaces = append(interfaces, linodego.InstanceConfigInterfaceCreateOptions{
+			Purpose:     linodego.InterfacePurposeVLAN,
+			Label:       d.VLANLabel,
+			IPAMAddress: d.VLANIPAMAddress,
+		})
+	}
+
+	return interfaces
+}
+
+// vpcInterface returns the VPC interface for a new instance
+func (d *Driver) vpcInterface() linodego.InstanceConfigInterfaceCreateOptions {
+	subnetID := d.VPCSubnetID
+	vpcInterface := linodego.InstanceConfigInterfaceCreateOptions{
+		Purpose:  linodego.InterfacePurposeVPC,
+		SubnetID: &subnetID,
+	}
+
+	if d.VPCIPv4 != "" || d.VPCNAT1To1 {
+		vpcInterface.IPv4 = &linodego.VPCIPv4{VPC: d.VPCIPv4}
+		if d.VPCNAT1To1 {
+			nat := vpcNAT1To1Any
+			vpcInterface.IPv4.NAT1To1 = &nat
+		}
+	}
+
+	return vpcInterface
+}
+
+// findStackScript returns the StackScript exactly matching StackScriptUser and
+// StackScriptLabel, failing when no script or more than one script matches
+func (d *Driver) findStackScript() (*linodego.Stackscript, error) {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	/* N.B. username isn't on the list of filterable fields, however
+	   adding it doesn't make anything fail, so if it becomes
+	   filterable in future this will become more efficient */
+	options := map[string]interface{}{
+		"username": d.StackScriptUser,
+		"label":    d.StackScriptLabel,
+	}
+
+	if d.StackScriptPublic != "" {
+		public, err := strconv.ParseBool(d.StackScriptPublic)
+		if err != nil {
+			return nil, err
+		}
+
+		if public {
+			options["is_public"] = true
+		} else {
+			options["mine"] = true
+		}
+	}
+
+	b, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Page 0 requests every page of results
+	opts := linodego.NewListOptions(0, string(b))
+	stackscripts, err := d.getClient().ListStackscripts(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []linodego.Stackscript
+	for _, s := range stackscripts {
+		if s.Username == d.StackScriptUser && s.Label == d.StackScriptLabel {
+			matches = append(matches, s)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("StackScript not found: %s/%s", d.StackScriptUser, d.StackScriptLabel)
+	case 1:
+		return &matches[0], nil
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, s := range matches {
+		ids = append(ids, strconv.Itoa(s.ID))
+	}
+
+	return nil, fmt.Errorf("StackScript %s/%s is ambiguous, use one of the identifiers %s instead",
+		d.StackScriptUser, d.StackScriptLabel, strings.Join(ids, ", "))
+}
+
+// uploadStackScriptFile returns the private StackScript matching the sha256 of
+// StackScriptFile, creating it when no such StackScript exists on the account
+func (d *Driver) uploadStackScriptFile() (*linodego.Stackscript, error) {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	client := d.getClient()
+
+	content, err := os.ReadFile(d.StackScriptFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read linode-stackscript-file: %s", err)
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	b, err := json.Marshal(map[string]bool{"mine": true, "is_public": false})
+	if err != nil {
+		return nil, err
+	}
+
+	stackscripts, err := client.ListStackscripts(ctx, linodego.NewListOptions(0, string(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	// the label only carries a prefix of the hash, so uploads are matched on
+	// the full hash in the rev note
+	var script *linodego.Stackscript
+	for _, s := range stackscripts {
+		if s.RevNote == stackScriptRevNotePrefix+hash {
+			script = &s
+			break
+		}
+	}
+
+	if script != nil {
+		log.Infof("Reusing StackScript %d for %s", script.ID, d.StackScriptFile)
+	} else {
+		script, err = client.CreateStackscript(ctx, linodego.StackscriptCreateOptions{
+			Label:       stackScriptLabel(d.StackScriptFile, hash),
+			Description: fmt.Sprintf("Uploaded by docker-machine from %s", filepath.Base(d.StackScriptFile)),
+			Images:      []string{stackScriptAllImages},
+			IsPublic:    false,
+			RevNote:     stackScriptRevNotePrefix + hash,
+			Script:      string(content),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create StackScript from %s: %s", d.StackScriptFile, err)
+		}
+
+		log.Infof("Uploaded %s as StackScript %d", d.StackScriptFile, script.ID)
+	}
+
+	return script, nil
+}
+
+// validateStackScriptData checks the StackScript UDF data and image against
+// the fields and images declared by the StackScript
+func validateStackScriptData(script *linodego.Stackscript, data map[string]string, image string) error {
+	var problems []string
+
+	if !slices.Contains(script.Images, stackScriptAllImages) && !slices.Contains(script.Images, image) {
+		problems = append(problems, fmt.Sprintf("image %s is not supported (supported: %s)",
+			image, strings.Join(script.Images, ", ")))
+	}
+
+	udfs := map[string]linodego.StackscriptUDF{}
+	if script.UserDefinedFields != nil {
+		for _, udf := range *script.UserDefinedFields {
+			udfs[udf.Name] = udf
+		}
+	}
+
+	var unknown []string
+	for name := range data {
+		if _, ok := udfs[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		problems = append(problems, fmt.Sprintf("unknown fields: %s", strings.Join(unknown, ", ")))
+	}
+
+	if script.UserDefinedFields != nil {
+		for _, udf := range *script.UserDefinedFields {
+			value, ok := data[udf.Name]
+			if !ok {
+				if udf.Default == "" {
+					problems = append(problems, fmt.Sprintf("missing required field %s (%s)", udf.Name, udf.Label))
+				}
+				continue
+			}
+
+			if udf.OneOf != "" && !slices.Contains(splitUDFList(udf.OneOf), value) {
+				problems = append(problems, fmt.Sprintf("field %s must be one of %s", udf.Name, udf.OneOf))
+			}
+
+			if udf.ManyOf != "" {
+				allowed := splitUDFList(udf.ManyOf)
+				for _, v := range splitUDFList(value) {
+					if !slices.Contains(allowed, v) {
+						problems = append(problems, fmt.Sprintf("field %s must be any of %s", udf.Name, udf.ManyOf))
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("StackScript %d (%s/%s) data is invalid: %s",
+			script.ID, script.Username, script.Label, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// splitUDFList splits a comma separated StackScript UDF list
+func splitUDFList(list string) []string {
+	values := strings.Split(list, ",")
+	for i, v := range values {
+		values[i] = strings.TrimSpace(v)
+	}
+	return values
+}
+
+// selectProfileSSHKeys returns the public keys of the profile SSH keys matching
+// labels, where the label "all" selects every key
+func selectProfileSSHKeys(keys []linodego.SSHKey, labels []string) ([]string, error) {
+	keysByLabel := make(map[string]string, len(keys))
+	available := make([]string, 0, len(keys))
+	all := make([]string, 0, len(keys))
+	for _, key := range keys {
+		keysByLabel[key.Label] = strings.TrimSpace(key.SSHKey)
+		available = append(available, key.Label)
+		all = append(all, strings.TrimSpace(key.SSHKey))
+	}
+
+	var selected, unknown []string
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == allProfileSSHKeys {
+			return all, nil
+		}
+
+		if key, ok := keysByLabel[label]; ok {
+			selected = append(selected, key)
+		} else {
+			unknown = append(unknown, label)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("profile SSH keys not found: %s (available: %s)",
+			strings.Join(unknown, ", "), strings.Join(available, ", "))
+	}
+
+	return selected, nil
+}
+
+// findAdoptedInstance resolves the existing instance to adopt by InstanceID,
+// or by InstanceLabel when no ID is given
+func (d *Driver) findAdoptedInstance() error {
+	if d.InstanceID != 0 {
+		ctx, cancel := d.apiContext()
+		defer cancel()
+
+		if _, err := d.getClient().GetInstance(ctx, d.InstanceID); err != nil {
+			return fmt.Errorf("Linode %d could not be adopted: %s", d.InstanceID, err)
+		}
+
+		return nil
+	}
+
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	instance, err := d.findInstanceByLabel(ctx, d.InstanceLabel)
+	if err != nil {
+		return err
+	}
+
+	if instance == nil {
+		return fmt.Errorf("Linode %q could not be adopted: instance not found", d.InstanceLabel)
+	}
+
+	d.InstanceID = instance.ID
+	return nil
+}
+
+// tokenScope is an OAuth scope required of the API token
+type tokenScope struct {
+	name  string
+	level string
+}
+
+// eventsScope is needed to wait for the events of lifecycle requests
+var eventsScope = tokenScope{"events", scopeReadOnly}
+
+// requiredScopes returns the token scopes used to create the machine
+func (d *Driver) requiredScopes() []tokenScope {
+	scopes := []tokenScope{
+		{"linodes", scopeReadWrite},
+	}
+
+	// the instance is only booted through the event poller when the
+	// Network Helper is enabled for a private IP
+	if d.CreatePrivateIP {
+		scopes = append(scopes, eventsScope)
+	}
+
+	if d.StackScriptFile != "" {
+		scopes = append(scopes, tokenScope{"stackscripts", scopeReadWrite})
+	} else if d.StackScriptID != 0 || d.StackScriptUser != "" {
+		scopes = append(scopes, tokenScope{"stackscripts", scopeReadOnly})
+	}
+
+	if d.CreateFirewall || d.FirewallID != 0 {
+		scopes = append(scopes, tokenScope{"firewall", scopeReadWrite})
+	}
+
+	if d.useVPC() {
+		scopes = append(scopes, tokenScope{"vpc", scopeReadWrite})
+	}
+
+	return scopes
+}
+
+// missingScopes returns the required scopes which are not granted by the
+// token scopes, e.g. "*" or "linodes:read_write,events:read_only"
+func missingScopes(granted string, required []tokenScope) []string {
+	levels := map[string]string{}
+	for _, scope := range strings.FieldsFunc(granted, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if scope == "*" {
+			return nil
+		}
+
+		name, level, _ := strings.Cut(scope, ":")
+		if level == "*" {
+			level = scopeReadWrite
+		}
+		levels[name] = level
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if levels[scope.name] == scopeReadWrite || levels[scope.name] == scope.level {
+			continue
+		}
+		missing = append(missing, fmt.Sprintf("scope %s:%s", scope.name, scope.level))
+	}
+	return missing
+}
+
+// missingGrants returns the grants a restricted user lacks to create the
+// machine
+func (d *Driver) missingGrants(grants *linodego.UserGrants) []string {
+	var missing []string
+	if !grants.Global.AddLinodes {
+		missing = append(missing, "grant add_linodes")
+	}
+
+	if d.CreateFirewall && !grants.Global.AddFirewalls {
+		missing = append(missing, "grant add_firewalls")
+	}
+
+	if d.StackScriptFile != "" && !grants.Global.AddStackScripts {
+		missing = append(missing, "grant add_stackscripts")
+	}
+
+	if d.FirewallID != 0 && !slices.ContainsFunc(grants.Firewall, func(g linodego.GrantedEntity) bool {
+		return g.ID == d.FirewallID && g.Permissions == linodego.AccessLevelReadWrite
+	}) {
+		missing = append(missing, fmt.Sprintf("read_write grant on firewall %d", d.FirewallID))
+	}
+
+	return missing
+}
+
+// checkTokenScopes verifies that the API token and its user may make the
+// requests needed to create the machine, reporting everything missing in a
+// single error. Listing the token scopes requires account access, so the
+// scope check is skipped for tokens without it.
+func (d *Driver) checkTokenScopes() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	client := d.getClient()
+
+	token, err := d.apiToken()
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+
+	tokens, err := client.ListTokens(ctx, nil)
+	if err != nil {
+		log.Warnf("Unable to verify the Linode API token scopes: %s", err)
+	} else {
+		for _, t := range tokens {
+			if t.Token != "" && strings.HasPrefix(token, t.Token) {
+				missing = append(missing, missingScopes(t.Scopes, d.requiredScopes())...)
+				if !d.CreatePrivateIP && len(missingScopes(t.Scopes, []tokenScope{eventsScope})) > 0 {
+					log.Warnf("The Linode API token lacks the events:read_only scope, which docker-machine start, stop and restart need")
+				}
+				break
+			}
+		}
+	}
+
+	profile, err := client.GetProfile(ctx)
+	if err != nil {
+		log.Warnf("Unable to verify the Linode user grants: %s", err)
+	} else if profile.Restricted {
+		grants, err := client.GrantsList(ctx)
+		if err != nil {
+			log.Warnf("Unable to verify the Linode user grants: %s", err)
+		} else {
+			missing = append(missing, d.missingGrants(grants)...)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the Linode API token cannot create this machine, it is missing: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// checkDeployment verifies that Region, InstanceType and InstanceImage exist,
+// that the type is offered in the region, and that the region and image
+// support the features requested for the instance
+func (d *Driver) checkDeployment() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	client := d.getClient()
+
+	regions, err := client.ListRegions(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list regions: %s", err)
+	}
+
+	var region *linodego.Region
+	regionIDs := make([]string, 0, len(regions))
+	for i := range regions {
+		regionIDs = append(regionIDs, regions[i].ID)
+		if regions[i].ID == d.Region {
+			region = &regions[i]
+		}
+	}
+
+	if region == nil {
+		// Region aliases are not listed but are resolved by the API
+		if region, err = client.GetRegion(ctx, d.Region); err != nil {
+			return notFoundError("region", d.Region, regionIDs)
+		}
+	}
+
+	d.Region = region.ID
+
+	var missing []string
+	for _, capability := range d.requiredCapabilities() {
+		if !slices.Contains(region.Capabilities, capability) {
+			missing = append(missing, capability)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("linode region %s does not support %s", d.Region, strings.Join(missing, ", "))
+	}
+
+	types, err := client.ListTypes(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list instance types: %s", err)
+	}
+
+	typeIDs := make([]string, 0, len(types))
+	for _, t := range types {
+		typeIDs = append(typeIDs, t.ID)
+	}
+
+	if !slices.Contains(typeIDs, d.InstanceType) {
+		return notFoundError("instance type", d.InstanceType, typeIDs)
+	}
+
+	availability, err := client.GetRegionAvailability(ctx, d.Region)
+	if err != nil {
+		return fmt.Errorf("failed to get availability of region %s: %s", d.Region, err)
+	}
+
+	for _, a := range availability {
+		if a.Plan == d.InstanceType && !a.Available {
+			return fmt.Errorf("linode instance type %s is not available in region %s", d.InstanceType, d.Region)
+		}
+	}
+
+	images, err := client.ListImages(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list images: %s", err)
+	}
+
+	var image *linodego.Image
+	imageIDs := make([]string, 0, len(images))
+	for i := range images {
+		imageIDs = append(imageIDs, images[i].ID)
+		if images[i].ID == d.InstanceImage {
+			image = &images[i]
+		}
+	}
+
+	if image == nil {
+		return notFoundError("image", d.InstanceImage, imageIDs)
+	}
+
+	if image.Deprecated {
+		return fmt.Errorf("linode image %s is deprecated", d.InstanceImage)
+	}
+
+	if d.UserData != "" && !slices.Contains(image.Capabilities, imageCapabilityCloudInit) {
+		return fmt.Errorf("linode image %s does not support cloud-init user data", d.InstanceImage)
+	}
+
+	return nil
+}
+
+// checkLabel ensures that InstanceLabel is not used by another instance on
+// the account, appending a random suffix when LabelConflict allows it
+func (d *Driver) checkLabel() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	for attempt := 0; attempt < labelSuffixAttempts; attempt++ {
+		instance, err := d.findInstanceByLabel(ctx, d.InstanceLabel)
+		if err != nil {
+			return err
+		}
+
+		if instance == nil {
+			return nil
+		}
+
+		if d.LabelConflict != labelConflictSuffix {
+			return fmt.Errorf("linode label %q is already used by instance %d", d.InstanceLabel, instance.ID)
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return err
+		}
+
+		label := suffixLabel(d.InstanceLabel, hex.EncodeToString(suffix))
+		log.Warnf("Linode label %q is already used by instance %d, trying %q", d.InstanceLabel, instance.ID, label)
+		d.InstanceLabel = label
+	}
+
+	return fmt.Errorf("failed to find an unused linode label after %d attempts", labelSuffixAttempts)
+}
+
+// findInstanceByLabel returns the instance with the given label, or nil
+func (d *Driver) findInstanceByLabel(ctx context.Context, label string) (*linodego.Instance, error) {
+	b, err := json.Marshal(map[string]string{"label": label})
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := d.getClient().ListInstances(ctx, linodego.NewListOptions(0, string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %s", err)
+	}
+
+	for _, instance := range instances {
+		if instance.Label == label {
+			return &instance, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// suffixLabel appends suffix to label, truncating label so that the result
+// remains within the Linode label length limit
+func suffixLabel(label, suffix string) string {
+	maxLength := labelMaxLength - len(suffix) - 1
+	if len(label) > maxLength {
+		label = strings.TrimRight(label[:maxLength], noLabelDuplicates)
+	}
+
+	return label + "-" + suffix
+}
+
+// requiredCapabilities returns the region capabilities needed by the
+// requested instance options
+func (d *Driver) requiredCapabilities() []string {
+	capabilities := []string{linodego.CapabilityLinodes}
+
+	if d.UserData != "" {
+		capabilities = append(capabilities, linodego.CapabilityMetadata)
+	}
+
+	if d.useVPC() {
+		capabilities = append(capabilities, linodego.CapabilityVPCs)
+	}
+
+	if d.VLANLabel != "" {
+		capabilities = append(capabilities, linodego.CapabilityVlans)
+	}
+
+	if d.FirewallID != 0 || d.CreateFirewall {
+		capabilities = append(capabilities, linodego.CapabilityCloudFirewall)
+	}
+
+	if d.PlacementGroupID != 0 || d.PlacementGroupLabel != "" || d.CreatePlacementGroup {
+		capabilities = append(capabilities, linodego.CapabilityPlacementGroup)
+	}
+
+	return capabilities
+}
+
+// notFoundError reports an unknown value along with the closest valid values
+func notFoundError(kind, value string, candidates []string) error {
+	suggestions := suggest(value, candidates)
+	if len(suggestions) == 0 {
+		return fmt.Errorf("linode %s %q not found", kind, value)
+	}
+
+	return fmt.Errorf("linode %s %q not found, did you mean %s?", kind, value, strings.Join(suggestions, ", "))
+}
+
+// suggest returns up to three candidates that are the closest match to value
+func suggest(value string, candidates []string) []string {
+	maxDistance := len(value)/3 + 1
+
+	distances := map[string]int{}
+	var suggestions []string
+	for _, c := range candidates {
+		distance := levenshtein(strings.ToLower(value), strings.ToLower(c))
+		if distance <= maxDistance {
+			distances[c] = distance
+			suggestions = append(suggestions, c)
+		}
+	}
+
+	slices.SortStableFunc(suggestions, func(a, b string) int {
+		return distances[a] - distances[b]
+	})
+
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+
+	return suggestions
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// Create a host using the driver's config
+func (d *Driver) Create() (err error) {
+	if d.Adopted {
+		return d.adoptInstance()
+	}
+
+	log.Info("Creating Linode machine instance...")
+
+	defer func() {
+		if err != nil {
+			d.rollbackCreate()
+		}
+	}()
+
+	if d.SSHPort != defaultSSHPort {
+		log.Infof("Using SSH port %d", d.SSHPort)
+	}
+
+	publicKey, err := d.createSSHKey()
+	if err != nil {
+		return err
+	}
+
+	client := d.getClient()
+	boolBooted := !d.CreatePrivateIP
+
+	// Create a linode
+	createOpts := linodego.InstanceCreateOptions{
+		Region:         d.Region,
+		Type:           d.InstanceType,
+		Label:          d.InstanceLabel,
+		RootPass:       d.RootPassword,
+		AuthorizedKeys: []string{strings.TrimSpace(publicKey)},
+		Image:          d.InstanceImage,
+		SwapSize:       &d.SwapSize,
+		PrivateIP:      d.CreatePrivateIP,
+		Booted:         &boolBooted,
+		Interfaces:     d.createInterfaces(),
+	}
+
+	if len(d.AuthorizedUsers) > 0 {
+		createOpts.AuthorizedUsers = strings.Split(d.AuthorizedUsers, ",")
+	}
+
+	createOpts.AuthorizedKeys = append(createOpts.AuthorizedKeys, d.AuthorizedKeys...)
+
+	if d.Tags != "" {
+		createOpts.Tags = strings.Split(d.Tags, ",")
+	}
+
+	if d.CreateFirewall {
+		if err := d.createFirewall(); err != nil {
+			return err
+		}
+	}
+
+	if d.FirewallID != 0 {
+		createOpts.FirewallID = d.FirewallID
+	}
+
+	if d.PlacementGroupID == 0 && d.CreatePlacementGroup {
+		if err := d.createPlacementGroup(); err != nil {
+			return err
+		}
+	}
+
+	if d.PlacementGroupID != 0 {
+		createOpts.PlacementGroup = &linodego.InstanceCreatePlacementGroupOptions{
+			ID: d.PlacementGroupID,
+		}
+	}
+
+	if d.StackScriptID != 0 {
+		createOpts.StackScriptID = d.StackScriptID
+		createOpts.StackScriptData = d.StackScriptData
+		log.Infof("Using StackScript %d: %s/%s", d.StackScriptID, d.StackScriptUser, d.StackScriptLabel)
+	}
+
+	if d.UserData != "" {
+		createOpts.Metadata = &linodego.InstanceMetadataOptions{
+			UserData: d.UserData,
+		}
+	}
+
+	linode, err := d.createInstance(createOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	d.InstanceID = linode.ID
+	d.InstanceLabel = linode.Label
+
+	// Don't persist alias region names
+	d.Region = linode.Region
+
+	d.setIPAddresses(linode, d.CreatePrivateIP)
+
+	if d.IPAddress == "" {
+		return errors.New("Linode IP Address is not found")
+	}
+
+	if d.UseIPv6 && d.IPv6Address == "" {
+		return errors.New("Linode IPv6 Address is not found")
+	}
+
+	if d.CreatePrivateIP && d.PrivateIPAddress == "" {
+		return errors.New("Linode Private IP Address is not found")
+	}
+
+	if d.useVPC() {
+		addresses, err := client.GetInstanceIPAddresses(ctx, linode.ID)
+		if err != nil {
+			return err
+		}
+
+		if addresses.IPv4 == nil {
+			return errors.New("Linode VPC IP Address is not found")
+		}
+
+		for _, address := range addresses.IPv4.VPC {
+			if address.SubnetID == d.VPCSubnetID && address.Address != nil {
+				d.VPCID = address.VPCID
+				d.VPCIPAddress = *address.Address
+				break
+			}
+		}
+
+		if d.VPCIPAddress == "" {
+			return errors.New("Linode VPC IP Address is not found")
+		}
+	}
+
+	log.Debugf("Created Linode Instance %s (%d), IP address %q, IPv6 address %q, Private IP address %q, VPC IP address %q, VLAN IP address %q",
+		d.InstanceLabel,
+		d.InstanceID,
+		d.IPAddress,
+		d.IPv6Address,
+		d.PrivateIPAddress,
+		d.VPCIPAddress,
+		d.VLANIPAddress,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if d.CreatePrivateIP {
+		log.Debugf("Enabling Network Helper for Private IP configuration...")
+
+		configs, err := client.ListInstanceConfigs(ctx, linode.ID, nil)
+		if err != nil {
+			return err
+		}
+		if len(configs) == 0 {
+			return fmt.Errorf("Linode Config was not found for Linode %d", linode.ID)
+		}
+		updateOpts := configs[0].GetUpdateOptions()
+		updateOpts.Helpers.Network = true
+		if _, err := client.UpdateInstanceConfig(ctx, linode.ID, configs[0].ID, updateOpts); err != nil {
+			return err
+		}
+
+		if err := d.instanceAction(linodego.ActionLinodeBoot, linodego.InstanceRunning, func(ctx context.Context, client *linodego.Client) error {
+			return client.BootInstance(ctx, linode.ID, configs[0].ID)
+		}); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Waiting for Machine Running...")
+	if _, err := client.WaitForInstanceStatus(interruptContext(), d.InstanceID, linodego.InstanceRunning, d.getWaitTimeout()); err != nil {
+		return fmt.Errorf("wait for machine running failed: %s", err)
+	}
+
+	return nil
+}
+
+// createInstance creates the instance. A failed response does not mean that
+// no instance was created, so the instance is looked up by label before the
+// request is repeated. linodego retries rate limited and unavailable requests
+// of any method, so its retries are disabled while creating the instance.
+// All attempts share a single linode-api-timeout deadline.
+func (d *Driver) createInstance(createOpts linodego.InstanceCreateOptions) (*linodego.Instance, error) {
+	client := d.getClient()
+	client.SetRetryCount(0)
+	defer client.SetRetryCount(d.APIRetries)
+
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		linode, err := client.CreateInstance(ctx, createOpts)
+
+		if err == nil || !transientError(err) || attempt >= d.APIRetries {
+			return linode, err
+		}
+
+		log.Warnf("Creating Linode %s failed: %s", createOpts.Label, err)
+
+		existing, lookupErr := d.findInstanceByLabel(ctx, createOpts.Label)
+		if lookupErr != nil {
+			log.Warnf("Unable to check whether Linode %s was created: %s", createOpts.Label, lookupErr)
+			return nil, err
+		}
+
+		if existing != nil && existing.Region == createOpts.Region && existing.Type == createOpts.Type {
+			log.Infof("Linode %s was created as instance %d despite the error", createOpts.Label, existing.ID)
+			return existing, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(retryBackoff(attempt)):
+		}
+	}
+}
+
+// adoptInstance makes an existing instance a docker-machine host. The machine
+// SSH key is either copied from SSHKeySource, which must already be
+// authorized on the instance, or generated and installed over SSH using the
+// root password.
+func (d *Driver) adoptInstance() error {
+	log.Infof("Adopting Linode %d...", d.InstanceID)
+
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	linode, err := d.getClient().GetInstance(ctx, d.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	if linode.Status != linodego.InstanceRunning {
+		return fmt.Errorf("Linode %d is %s, only running instances can be adopted", d.InstanceID, linode.Status)
+	}
+
+	d.InstanceLabel = linode.Label
+	d.InstanceType = linode.Type
+	d.InstanceImage = linode.Image
+	d.Region = linode.Region
+	d.setIPAddresses(linode, true)
+
+	if d.IPAddress == "" {
+		return errors.New("Linode IP Address is not found")
+	}
+
+	if d.UseIPv6 && d.IPv6Address == "" {
+		return errors.New("Linode IPv6 Address is not found")
+	}
+
+	publicKey, err := d.createSSHKey()
+	if err != nil {
+		return err
+	}
+
+	if d.SSHKeySource == "" {
+		if err := d.pushSSHKey(publicKey); err != nil {
+			return fmt.Errorf("failed to install the SSH key on Linode %d: %s", d.InstanceID, err)
+		}
+	}
+
+	log.Debugf("Adopted Linode Instance %s (%d), IP address %q, IPv6 address %q, Private IP address %q",
+		d.InstanceLabel,
+		d.InstanceID,
+		d.IPAddress,
+		d.IPv6Address,
+		d.PrivateIPAddress,
+	)
+
+	return nil
+}
+
+// setIPAddresses records the public IPv6 and IPv4 and, if requested,
+// private IPv4 addresses of the instance
+func (d *Driver) setIPAddresses(linode *linodego.Instance, includePrivate bool) {
+	d.IPv6Address = slaacAddress(linode.IPv6)
+
+	for _, address := range linode.IPv4 {
+		if private := privateIP(*address); !private {
+			d.IPAddress = address.String()
+		} else if includePrivate {
+			d.PrivateIPAddress = address.String()
+		}
+	}
+}
+
+// slaacAddress strips the prefix length from the instance SLAAC address,
+// e.g. 2600:3c03::f03c:91ff:fe24:3a2f/128
+func slaacAddress(ipv6 string) string {
+	address, _, _ := strings.Cut(ipv6, "/")
+	return address
+}
+
+// refreshIPAddresses updates the cached addresses when they are no longer
+// assigned to the instance
+func (d *Driver) refreshIPAddresses(linode *linodego.Instance) {
+	d.ipRefreshed = true
+
+	if ipv6 := slaacAddress(linode.IPv6); ipv6 != "" && ipv6 != d.IPv6Address {
+		if d.UseIPv6 && d.IPv6Address != "" {
+			log.Warnf("Linode %d IPv6 address changed from %s to %s, run \"docker-machine regenerate-certs\" to update its certificates",
+				d.InstanceID, d.IPv6Address, ipv6)
+		}
+		d.IPv6Address = ipv6
+	}
+
+	var publicCurrent, privateCurrent bool
+	for _, address := range linode.IPv4 {
+		publicCurrent = publicCurrent || address.String() == d.IPAddress
+		privateCurrent = privateCurrent || address.String() == d.PrivateIPAddress
+	}
+
+	includePrivate := d.CreatePrivateIP || d.PrivateIPAddress != ""
+	if publicCurrent && (privateCurrent || !includePrivate) {
+		return
+	}
+
+	previous := d.IPAddress
+	d.setIPAddresses(linode, includePrivate)
+
+	if publicCurrent {
+		d.IPAddress = previous
+	} else if previous != "" && d.IPAddress != previous {
+		log.Warnf("Linode %d IP address changed from %s to %s, run \"docker-machine regenerate-certs\" to update its certificates",
+			d.InstanceID, previous, d.IPAddress)
+	}
+}
+
+// pushSSHKey appends publicKey to the authorized keys of the SSH user,
+// logging in as root with the root password
+func (d *Driver) pushSSHKey(publicKey string) error {
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return err
+	}
+
+	config := &cryptossh.ClientConfig{
+		User: defaultSSHUser,
+		Auth: []cryptossh.AuthMethod{cryptossh.Password(d.RootPassword)},
+		// The host key of an adopted instance is not known in advance, so a
+		// man-in-the-middle on this first connection would receive the root
+		// password.
+		HostKeyCallback: cryptossh.InsecureIgnoreHostKey(),
+		Timeout:         sshKeyPushTimeout,
+	}
+
+	host, err := d.GetSSHHostname()
+	if err != nil {
+		return err
+	}
+
+	conn, err := cryptossh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	command := "umask 077 && mkdir -p ~/.ssh && cat >> ~/.ssh/authorized_keys"
+	if user := d.GetSSHUsername(); user != defaultSSHUser {
+		// install the key in the home of the SSH user rather than of root
+		quoted := "'" + strings.ReplaceAll(user, "'", `'\''`) + "'"
+		command = fmt.Sprintf(`umask 077 && home=$(getent passwd %[1]s | cut -d: -f6) && test -n "$home" && `+
+			`mkdir -p "$home/.ssh" && cat >> "$home/.ssh/authorized_keys" && chown -R %[1]s: "$home/.ssh"`, quoted)
+	}
+
+	session.Stdin = strings.NewReader(strings.TrimSpace(publicKey) + "\n")
+	return session.Run(command)
+}
+
+// rollbackCreate removes the resources created by a failed Create, unless
+// KeepOnFailure is set. Failures are logged rather than returned so that the
+// original Create error is reported.
+func (d *Driver) rollbackCreate() {
+	if d.KeepOnFailure {
+		log.Warnf("Keeping resources of the failed machine (Linode %d, firewall %d, placement group %d)",
+			d.InstanceID, d.FirewallID, d.PlacementGroupID)
+		return
+	}
+
+	// cleanup must proceed when Create was interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.getAPITimeout())*time.Second)
+	defer cancel()
+
+	client := d.getClient()
+
+	instanceID := d.InstanceID
+	if d.InstanceID != 0 {
+		if err := client.DeleteInstance(ctx, d.InstanceID); err != nil && !isNotFound(err) {
+			log.Errorf("Failed to remove Linode %d: %s", d.InstanceID, err)
+		} else {
+			log.Infof("Removed Linode %d of the failed machine", d.InstanceID)
+			d.InstanceID = 0
+		}
+	}
+
+	if d.CreateFirewall && d.FirewallID != 0 {
+		if err := client.DeleteFirewall(ctx, d.FirewallID); err != nil && !isNotFound(err) {
+			log.Errorf("Failed to remove firewall %d: %s", d.FirewallID, err)
+		} else {
+			log.Infof("Removed firewall %d of the failed machine", d.FirewallID)
+			d.FirewallID = 0
+		}
+	}
+
+	if d.PlacementGroupCreated && d.PlacementGroupID != 0 {
+		if err := d.removePlacementGroup(ctx, instanceID); err != nil {
+			log.Errorf("Failed to remove placement group %d: %s", d.PlacementGroupID, err)
+		}
+	}
+}
+
+// GetURL returns a Docker compatible host URL for connecting to this host
+// e.g. tcp://1.2.3.4:2376 or tcp://[2600:3c03::1]:2376
+func (d *Driver) GetURL() (string, error) {
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	if ip == "" {
+		return "", nil
+	}
+
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, strconv.Itoa(d.DockerPort))), nil
+}
+
+// GetState returns the state that the host is in (running, stopped, etc).
+// The raw Linode status is recorded in InstanceStatus.
 func (d *Driver) GetState() (state.State, error) {
-	linode, err := d.getClient().GetInstance(context.TODO(), d.InstanceID)
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	client := d.getClient()
+	linode, err := client.GetInstance(ctx, d.InstanceID)
+	if isNotFound(err) {
+		return state.None, fmt.Errorf("Linode %d no longer exists", d.InstanceID)
+	}
 	if err != nil {
 		return state.Error, err
 	}
 
-	switch linode.Status {
+	d.refreshIPAddresses(linode)
+	d.InstanceStatus = string(linode.Status)
+
+	return instanceState(linode.Status), nil
+}
+
+// instanceState maps a Linode status onto a docker-machine state
+func instanceState(status linodego.InstanceStatus) state.State {
+	switch status {
 	case linodego.InstanceRunning:
-		return state.Running, nil
-	case linodego.InstanceOffline,
-		linodego.InstanceRebuilding,
-		linodego.InstanceMigrating:
-		return state.Stopped, nil
+		return state.Running
+	case linodego.InstanceOffline:
+		return state.Stopped
 	case linodego.InstanceShuttingDown, linodego.InstanceDeleting:
-		return state.Stopping, nil
+		return state.Stopping
 	case linodego.InstanceProvisioning,
-		linodego.InstanceRebooting,
 		linodego.InstanceBooting,
-		linodego.InstanceCloning,
-		linodego.InstanceRestoring:
-		return state.Starting, nil
+		linodego.InstanceRebooting,
+		linodego.InstanceRebuilding,
+		linodego.InstanceRestoring,
+		// the instance is unavailable until Linode completes the operation
+		// and returns it to its previous power state
+		linodego.InstanceMigrating,
+		linodego.InstanceResizing,
+		linodego.InstanceCloning:
+		return state.Starting
+	}
+
+	return state.None
+}
+
+// pendingMaintenance describes the maintenance scheduled or in progress for
+// the instance. Tokens without account access cannot list maintenance, so
+// failures are only logged.
+func (d *Driver) pendingMaintenance(ctx context.Context, client *linodego.Client) []string {
+	// only request the maintenance of this instance, rather than every
+	// maintenance of the account
+	b, err := json.Marshal(map[string]interface{}{"entity.type": "linode", "entity.id": d.InstanceID})
+	if err != nil {
+		return nil
+	}
 
+	maintenances, err := client.ListMaintenances(ctx, linodego.NewListOptions(0, string(b)))
+	if err != nil {
+		log.Debugf("Unable to list maintenance for Linode %d: %s", d.InstanceID, err)
+		return nil
 	}
 
-	// deleting, migrating, rebuilding, cloning, restoring ...
-	return state.None, nil
+	var pending []string
+	for _, m := range maintenances {
+		if m.Entity == nil || m.Entity.Type != "linode" || m.Entity.ID != d.InstanceID {
+			continue
+		}
+		if m.Status == maintenanceCompleted || m.Status == maintenanceCanceled {
+			continue
+		}
+
+		description := fmt.Sprintf("%s %s", m.Type, m.Status)
+		if m.NotBefore != nil {
+			description += " not before " + m.NotBefore.Format(time.RFC3339)
+		}
+		pending = append(pending, description)
+	}
+	return pending
 }
 
 // Start a host
 func (d *Driver) Start() error {
 	log.Debug("Start...")
-	err := d.getClient().BootInstance(context.TODO(), d.InstanceID, 0)
-	return err
+	return d.instanceAction(linodego.ActionLinodeBoot, linodego.InstanceRunning, func(ctx context.Context, client *linodego.Client) error {
+		return client.BootInstance(ctx, d.InstanceID, 0)
+	})
 }
 
 // Stop a host gracefully
 func (d *Driver) Stop() error {
 	log.Debug("Stop...")
-	err := d.getClient().ShutdownInstance(context.TODO(), d.InstanceID)
-	return err
+	return d.instanceAction(linodego.ActionLinodeShutdown, linodego.InstanceOffline, func(ctx context.Context, client *linodego.Client) error {
+		return client.ShutdownInstance(ctx, d.InstanceID)
+	})
 }
 
-// Remove a host
+// Remove a host. Adopted instances are left in place.
 func (d *Driver) Remove() error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
 	client := d.getClient()
-	log.Infof("Removing linode: %d", d.InstanceID)
-	if err := client.DeleteInstance(context.TODO(), d.InstanceID); err != nil {
-		if apiErr, ok := err.(*linodego.Error); ok && apiErr.Code == 404 {
+	if d.Adopted {
+		log.Infof("Leaving adopted linode in place: %d", d.InstanceID)
+	} else {
+		log.Infof("Removing linode: %d", d.InstanceID)
+		if err := client.DeleteInstance(ctx, d.InstanceID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+
 			log.Debug("Linode was already removed")
+		}
+	}
+
+	if d.CreateFirewall && d.FirewallID != 0 {
+		log.Infof("Removing firewall: %d", d.FirewallID)
+		if err := client.DeleteFirewall(ctx, d.FirewallID); err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+
+			log.Debug("Firewall was already removed")
+		}
+	}
+
+	// the instance is deleted asynchronously and may still be a member, so
+	// a placement group that cannot be removed yet is left for the user
+	if d.PlacementGroupCreated && d.PlacementGroupID != 0 {
+		if err := d.removePlacementGroup(ctx, d.InstanceID); err != nil {
+			log.Warnf("Failed to remove placement group %d: %s", d.PlacementGroupID, err)
+		}
+	}
+
+	return nil
+}
+
+// removePlacementGroup deletes the placement group created by this machine
+// once it has no members other than instanceID
+func (d *Driver) removePlacementGroup(ctx context.Context, instanceID int) error {
+	client := d.getClient()
+
+	pg, err := client.GetPlacementGroup(ctx, d.PlacementGroupID)
+	if err != nil {
+		if isNotFound(err) {
+			log.Debug("Placement group was already removed")
 			return nil
 		}
 
 		return err
 	}
+
+	for _, member := range pg.Members {
+		if member.LinodeID != instanceID {
+			log.Infof("Keeping placement group %d, it still has %d members", d.PlacementGroupID, len(pg.Members))
+			return nil
+		}
+	}
+
+	log.Infof("Removing placement group: %d", d.PlacementGroupID)
+	if err := client.DeletePlacementGroup(ctx, d.PlacementGroupID); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.PlacementGroupID = 0
+	d.PlacementGroupCreated = false
 	return nil
 }
 
+// retryTransientError is a retry condition for server and network errors.
+// Only idempotent requests are retried, as the API may have processed a
+// request whose response was lost. linodego itself retries rate limited
+// (429) and unavailable (503) requests of any method, honoring Retry-After,
+// which createInstance disables for CreateInstance.
+func retryTransientError(r *resty.Response, err error) bool {
+	if r == nil || r.Request == nil {
+		return false
+	}
+
+	switch r.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	return r.StatusCode() >= http.StatusInternalServerError
+}
+
+// transientError determines if a failed request may succeed when repeated
+func transientError(err error) bool {
+	var apiErr *linodego.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.Code == linodego.ErrorFromError ||
+		apiErr.Code == http.StatusTooManyRequests ||
+		apiErr.Code >= http.StatusInternalServerError
+}
+
+// retryBackoff returns the exponential, jittered delay before a retry
+func retryBackoff(attempt int) time.Duration {
+	backoff := apiRetryMaxWaitTime
+	if attempt < 6 {
+		backoff = min(apiRetryWaitTime<<attempt, apiRetryMaxWaitTime)
+	}
+
+	jitter := make([]byte, 1)
+	if _, err := rand.Read(jitter); err != nil {
+		return backoff
+	}
+
+	return backoff/2 + backoff/2*time.Duration(jitter[0])/255
+}
+
+// isNotFound determines if an error is a Linode API 404 response
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*linodego.Error)
+	return ok && apiErr.Code == 404
+}
+
 // Restart a host. This may just call Stop(); Start() if the provider does not
 // have any special restart behaviour.
 func (d *Driver) Restart() error {
 	log.Debug("Restarting...")
-	err := d.getClient().RebootInstance(context.TODO(), d.InstanceID, 0)
-	return err
+	return d.instanceAction(linodego.ActionLinodeReboot, linodego.InstanceRunning, func(ctx context.Context, client *linodego.Client) error {
+		return client.RebootInstance(ctx, d.InstanceID, 0)
+	})
+}
+
+// instanceAction sends a lifecycle request for the instance and waits for the
+// resulting event to finish and for the instance to reach the target status.
+// A failed event is returned as an error.
+func (d *Driver) instanceAction(action linodego.EventAction, target linodego.InstanceStatus, request func(ctx context.Context, client *linodego.Client) error) error {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	client := d.getClient()
+
+	poller, err := client.NewEventPoller(ctx, d.InstanceID, linodego.EntityLinode, action)
+	if err != nil {
+		return err
+	}
+
+	if err := request(ctx, client); err != nil {
+		return err
+	}
+
+	if _, err := poller.WaitForFinished(interruptContext(), d.getWaitTimeout()); err != nil {
+		return fmt.Errorf("%s of Linode %d failed: %s", action, d.InstanceID, err)
+	}
+
+	if _, err := client.WaitForInstanceStatus(interruptContext(), d.InstanceID, target, d.getWaitTimeout()); err != nil {
+		return fmt.Errorf("wait for machine %s failed: %s", target, err)
+	}
+
+	d.recordInstanceStatus(target)
+	return nil
+}
+
+// recordInstanceStatus records status and the maintenance scheduled for the
+// instance. docker-machine stores them once a start, stop, restart or kill
+// command completes, which avoids listing maintenance on every GetState.
+func (d *Driver) recordInstanceStatus(status linodego.InstanceStatus) {
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	d.InstanceStatus = string(status)
+	d.PendingMaintenance = d.pendingMaintenance(ctx, d.getClient())
 }
 
-// Kill stops a host forcefully
+// Kill stops a host forcefully. A shutdown is requested first, and if the
+// guest does not halt within KillGracePeriod the instance is forced off.
 func (d *Driver) Kill() error {
 	log.Debug("Killing...")
-	err := d.getClient().ShutdownInstance(context.TODO(), d.InstanceID)
+	client := d.getClient()
+
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	if err := client.ShutdownInstance(ctx, d.InstanceID); err != nil {
+		return err
+	}
+
+	// the grace period is also applied here, so that running out of it can
+	// be told apart from API errors while waiting
+	gracePeriod := d.getKillGracePeriod()
+	waitCtx, waitCancel := context.WithTimeout(interruptContext(), time.Duration(gracePeriod)*time.Second)
+	defer waitCancel()
+
+	_, err := client.WaitForInstanceStatus(waitCtx, d.InstanceID, linodego.InstanceOffline, gracePeriod)
+	switch {
+	case err == nil:
+		log.Infof("Linode %d was stopped gracefully", d.InstanceID)
+		d.recordInstanceStatus(linodego.InstanceOffline)
+		return nil
+	case interruptContext().Err() != nil:
+		return fmt.Errorf("kill of Linode %d was interrupted: %s", d.InstanceID, err)
+	case waitCtx.Err() == nil:
+		return fmt.Errorf("wait for machine offline failed: %s", err)
+	}
+
+	// the guest may have halted just as the grace period ran out, and the
+	// context of the shutdown request may have expired while waiting
+	checkCtx, checkCancel := d.apiContext()
+	defer checkCancel()
+
+	linode, err := client.GetInstance(checkCtx, d.InstanceID)
+	if err != nil {
+		return err
+	}
+	if linode.Status == linodego.InstanceOffline {
+		log.Infof("Linode %d was stopped gracefully", d.InstanceID)
+		d.recordInstanceStatus(linodego.InstanceOffline)
+		return nil
+	}
+
+	log.Warnf("Linode %d did not shut down within %d seconds, stopping it from Rescue Mode...", d.InstanceID, gracePeriod)
+	if err := d.forcePowerOff(); err != nil {
+		return fmt.Errorf("stopping from Rescue Mode failed: %s", err)
+	}
+
+	log.Infof("Linode %d was stopped from Rescue Mode", d.InstanceID)
+	d.recordInstanceStatus(linodego.InstanceOffline)
+	return nil
+}
+
+// forcePowerOff attempts to stop an instance whose guest does not respond to
+// shutdown requests. The Linode API has no power off action, so the instance
+// is booted into Rescue Mode and shut down from there. Linode runs one
+// lifecycle job at a time, and linodego retries the rescue request, up to
+// APIRetries times, while the pending shutdown job keeps the instance busy.
+func (d *Driver) forcePowerOff() error {
+	client := d.getClient()
+
+	ctx, cancel := d.apiContext()
+	defer cancel()
+
+	if err := client.RescueInstance(ctx, d.InstanceID, linodego.InstanceRescueOptions{}); err != nil {
+		return err
+	}
+
+	if _, err := client.WaitForInstanceStatus(interruptContext(), d.InstanceID, linodego.InstanceRunning, d.getWaitTimeout()); err != nil {
+		return err
+	}
+
+	ctx, cancel = d.apiContext()
+	defer cancel()
+
+	if err := client.ShutdownInstance(ctx, d.InstanceID); err != nil {
+		return err
+	}
+
+	_, err := client.WaitForInstanceStatus(interruptContext(), d.InstanceID, linodego.InstanceOffline, d.getWaitTimeout())
 	return err
 }
 
 func (d *Driver) createSSHKey() (string, error) {
-	if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
-		return "", err
+	switch {
+	case d.SSHKeySource != "":
+		if err := d.copySSHKey(); err != nil {
+			return "", err
+		}
+	case d.SSHKeyType == sshKeyTypeED25519:
+		if err := d.generateED25519Key(); err != nil {
+			return "", err
+		}
+	default:
+		if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
+			return "", err
+		}
 	}
 
 	publicKey, err := os.ReadFile(d.publicSSHKeyPath())
@@ -593,6 +3073,73 @@ func (d *Driver) createSSHKey() (string, error) {
 	return string(publicKey), nil
 }
 
+// copySSHKey copies the SSHKeySource private key into the machine store and
+// derives its public key
+func (d *Driver) copySSHKey() error {
+	log.Infof("Using SSH key %s", d.SSHKeySource)
+
+	privateKey, err := readSSHPrivateKey(d.SSHKeySource)
+	if err != nil {
+		return err
+	}
+
+	signer, err := cryptossh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	return d.writeSSHKey(privateKey, signer.PublicKey())
+}
+
+// generateED25519Key creates a new ed25519 key pair in the machine store
+func (d *Driver) generateED25519Key() error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	block, err := cryptossh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		return err
+	}
+
+	sshPublicKey, err := cryptossh.NewPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	return d.writeSSHKey(pem.EncodeToMemory(block), sshPublicKey)
+}
+
+// writeSSHKey stores a private key and its public key at GetSSHKeyPath
+func (d *Driver) writeSSHKey(privateKey []byte, publicKey cryptossh.PublicKey) error {
+	if err := os.WriteFile(d.GetSSHKeyPath(), privateKey, 0600); err != nil {
+		return err
+	}
+
+	return os.WriteFile(d.publicSSHKeyPath(), cryptossh.MarshalAuthorizedKey(publicKey), 0600)
+}
+
+// readSSHPrivateKey reads an unencrypted SSH private key, returning an error
+// if the key cannot be used by docker-machine
+func readSSHPrivateKey(path string) ([]byte, error) {
+	privateKey, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read linode-ssh-key-path: %s", err)
+	}
+
+	if _, err := cryptossh.ParsePrivateKey(privateKey); err != nil {
+		var passphraseErr *cryptossh.PassphraseMissingError
+		if errors.As(err, &passphraseErr) {
+			return nil, fmt.Errorf("linode-ssh-key-path %s is protected by a passphrase, which docker-machine does not support", path)
+		}
+
+		return nil, fmt.Errorf("linode-ssh-key-path %s is not a valid SSH private key: %s", path, err)
+	}
+
+	return privateKey, nil
+}
+
 // publicSSHKeyPath is always SSH Key Path appended with ".pub"
 func (d *Driver) publicSSHKeyPath() string {
 	return d.GetSSHKeyPath() + ".pub"
@@ -671,8 +3218,8 @@ func normalizeInstanceLabel(label string) (string, error) {
 	result = newResult
 
 	// Truncate length
-	if len(result) > 64 {
-		result = result[:64]
+	if len(result) > labelMaxLength {
+		result = result[:labelMaxLength]
 		log.Warnf("The name for this machine exceeds the 64 character Linode label limit. Truncating to \"%s\"", result)
 	}
 
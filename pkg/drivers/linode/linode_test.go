@@ -1,12 +1,26 @@
 package linode
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/go-resty/resty/v2"
 	"github.com/google/go-cmp/cmp"
+	"github.com/linode/linodego"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -69,3 +83,820 @@ func TestNormalizeInstanceLabel(t *testing.T) {
 		t.Fatal(cmp.Diff(result, expectedResult))
 	}
 }
+
+func TestSetConfigFromFlagsUserData(t *testing.T) {
+	driver := NewDriver("", "")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"linode-token":     "PROJECT",
+			"linode-user-data": "#cloud-config\n",
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	err := driver.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Empty(t, checkFlags.InvalidFlags)
+	assert.Equal(t, "I2Nsb3VkLWNvbmZpZwo=", driver.UserData)
+
+	checkFlags.FlagsValues["linode-user-data-file"] = "user-data.yaml"
+	assert.Error(t, driver.SetConfigFromFlags(checkFlags))
+}
+
+func TestCreateInterfaces(t *testing.T) {
+	driver := NewDriver("", "")
+	assert.Nil(t, driver.createInterfaces())
+
+	driver.VPCSubnetID = 123
+	driver.VPCIPv4 = "10.0.0.5"
+	driver.VPCNAT1To1 = true
+
+	interfaces := driver.createInterfaces()
+	if assert.Len(t, interfaces, 2) {
+		assert.Equal(t, linodego.InterfacePurposePublic, interfaces[0].Purpose)
+		assert.Equal(t, linodego.InterfacePurposeVPC, interfaces[1].Purpose)
+		assert.Equal(t, 123, *interfaces[1].SubnetID)
+		assert.Equal(t, "10.0.0.5", interfaces[1].IPv4.VPC)
+		assert.Equal(t, "any", *interfaces[1].IPv4.NAT1To1)
+	}
+
+	driver.VLANLabel = "swarm"
+	driver.VLANIPAMAddress = "10.10.0.1/24"
+
+	interfaces = driver.createInterfaces()
+	if assert.Len(t, interfaces, 3) {
+		assert.Equal(t, linodego.InterfacePurposeVLAN, interfaces[2].Purpose)
+		assert.Equal(t, "swarm", interfaces[2].Label)
+		assert.Equal(t, "10.10.0.1/24", interfaces[2].IPAMAddress)
+	}
+}
+
+func TestFirewallAddresses(t *testing.T) {
+	driver := NewDriver("", "")
+
+	addresses, err := driver.firewallAddresses()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0.0.0.0/0"}, *addresses.IPv4)
+	assert.Equal(t, []string{"::/0"}, *addresses.IPv6)
+
+	driver.FirewallSourceCIDRs = "192.0.2.0/24, 2001:db8::/32"
+	addresses, err = driver.firewallAddresses()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24"}, *addresses.IPv4)
+	assert.Equal(t, []string{"2001:db8::/32"}, *addresses.IPv6)
+
+	driver.FirewallSourceCIDRs = "192.0.2.1"
+	_, err = driver.firewallAddresses()
+	assert.Error(t, err)
+}
+
+func TestStackScriptLabel(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	assert.Equal(t, "setup-abababababab", stackScriptLabel("/tmp/setup.sh", hash))
+
+	label := stackScriptLabel(strings.Repeat("x", 200)+".sh", hash)
+	assert.Len(t, label, stackScriptLabelMaxLength)
+	assert.True(t, strings.HasSuffix(label, "-abababababab"))
+}
+
+func TestResourceLabel(t *testing.T) {
+	driver := NewDriver("", "")
+	driver.InstanceLabel = "swarm-manager-01"
+
+	assert.Equal(t, "docker-machine-swarm-manager-01", driver.resourceLabel(firewallLabelMaxLength))
+
+	driver.InstanceLabel = "runner-abcdefgh-project-1234-concurrent-0-3f9a1c"
+	first := driver.resourceLabel(firewallLabelMaxLength)
+	assert.Len(t, first, firewallLabelMaxLength)
+	assert.True(t, strings.HasPrefix(first, "docker-machine-runner-a-"), first)
+
+	driver.InstanceLabel = "runner-abcdefgh-project-1234-concurrent-0-77e2b0"
+	second := driver.resourceLabel(firewallLabelMaxLength)
+	assert.Len(t, second, firewallLabelMaxLength)
+	assert.NotEqual(t, first, second)
+
+	// separators are not left before the hash
+	driver.InstanceLabel = "abcdef-.ghijklmnopqrstuvwxyz"
+	assert.Regexp(t, "^docker-machine-abcdef-[0-9a-f]{8}$", driver.resourceLabel(31))
+}
+
+// newTestDriver returns a driver with an API client for the given handler
+func newTestDriver(t *testing.T, handler http.Handler) *Driver {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := linodego.NewClient(server.Client())
+	client.SetBaseURL(server.URL)
+	client.SetPollDelay(10 * time.Millisecond)
+
+	driver := NewDriver("", "")
+	driver.SetClient(&client)
+
+	return driver
+}
+
+func TestCheckFirewallLabel(t *testing.T) {
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"page": 1, "pages": 1, "results": 1, "data": [
+			{"id": 42, "label": "docker-machine-kept"}
+		]}`))
+	}))
+
+	driver.InstanceLabel = "new"
+	assert.NoError(t, driver.checkFirewallLabel())
+
+	driver.InstanceLabel = "kept"
+	assert.EqualError(t, driver.checkFirewallLabel(),
+		"firewall docker-machine-kept (42) already exists, remove it or pass it as linode-firewall-id")
+}
+
+func TestRollbackCreate(t *testing.T) {
+	var deleted []string
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		deleted = append(deleted, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	driver.InstanceID = 123
+	driver.FirewallID = 456
+	driver.CreateFirewall = true
+	driver.rollbackCreate()
+
+	assert.Equal(t, []string{"/v4/linode/instances/123", "/v4/networking/firewalls/456"}, deleted)
+	assert.Zero(t, driver.InstanceID)
+	assert.Zero(t, driver.FirewallID)
+
+	deleted = nil
+	driver.InstanceID = 123
+	driver.KeepOnFailure = true
+	driver.rollbackCreate()
+
+	assert.Empty(t, deleted)
+	assert.Equal(t, 123, driver.InstanceID)
+}
+
+func TestRemovePlacementGroup(t *testing.T) {
+	members := []linodego.PlacementGroupMember{{LinodeID: 123}, {LinodeID: 456}}
+	var deleted []string
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		pg := linodego.PlacementGroup{ID: 7, Label: "docker-machine-ci", Region: "us-east", Members: members}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v4/placement/groups":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": []linodego.PlacementGroup{pg}, "page": 1, "pages": 1, "results": 1,
+			})
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(pg)
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			_, _ = w.Write([]byte("{}"))
+		}
+	}))
+
+	// an existing group is never removed by a machine joining it
+	driver.Region = "us-east"
+	driver.PlacementGroupLabel = "docker-machine-ci"
+	driver.CreatePlacementGroup = true
+	assert.NoError(t, driver.resolvePlacementGroup())
+	assert.Equal(t, 7, driver.PlacementGroupID)
+	assert.False(t, driver.PlacementGroupCreated)
+
+	driver.PlacementGroupCreated = true
+	driver.InstanceID = 456
+	assert.NoError(t, driver.removePlacementGroup(context.Background(), driver.InstanceID))
+	assert.Empty(t, deleted)
+
+	members = members[1:]
+	assert.NoError(t, driver.removePlacementGroup(context.Background(), driver.InstanceID))
+	assert.Equal(t, []string{"/v4/placement/groups/7"}, deleted)
+	assert.Zero(t, driver.PlacementGroupID)
+}
+
+func TestCreateSSHKey(t *testing.T) {
+	driver := NewDriver("machine", t.TempDir())
+	driver.SSHKeyPath = filepath.Join(t.TempDir(), "id_rsa")
+	driver.SSHKeyType = sshKeyTypeED25519
+
+	publicKey, err := driver.createSSHKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(publicKey, "ssh-ed25519 "))
+
+	copied := NewDriver("copy", t.TempDir())
+	copied.SSHKeyPath = filepath.Join(t.TempDir(), "id_rsa")
+	copied.SSHKeySource = driver.SSHKeyPath
+
+	copiedPublicKey, err := copied.createSSHKey()
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, copiedPublicKey)
+
+	_, err = readSSHPrivateKey(driver.publicSSHKeyPath())
+	assert.Error(t, err)
+}
+
+func TestSelectProfileSSHKeys(t *testing.T) {
+	keys := []linodego.SSHKey{
+		{Label: "laptop", SSHKey: "ssh-ed25519 AAAA1 laptop\n"},
+		{Label: "ci", SSHKey: "ssh-ed25519 AAAA2 ci"},
+	}
+
+	selected, err := selectProfileSSHKeys(keys, []string{"ci"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ssh-ed25519 AAAA2 ci"}, selected)
+
+	selected, err = selectProfileSSHKeys(keys, []string{"all"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ssh-ed25519 AAAA1 laptop", "ssh-ed25519 AAAA2 ci"}, selected)
+
+	_, err = selectProfileSSHKeys(keys, []string{"ci", "desktop"})
+	assert.EqualError(t, err, "profile SSH keys not found: desktop (available: laptop, ci)")
+}
+
+func TestUploadStackScriptFile(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "bootstrap.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/bash\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	revNote := "sha256:b875f928546aee7855cb1db9afc8ab3f1a8a34d43de5bbd62f7076d7ba9f3917"
+	var created bool
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(`{"data": [{"id": 1, "username": "me", "label": "bootstrap", "rev_note": "` + revNote + `"}], "page": 1, "pages": 1, "results": 1}`))
+		case http.MethodPost:
+			created = true
+			_, _ = w.Write([]byte(`{"id": 2, "username": "me", "label": "bootstrap-new"}`))
+		}
+	}))
+	driver.StackScriptFile = script
+
+	stackscript, err := driver.uploadStackScriptFile()
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, 1, stackscript.ID)
+
+	revNote = "sha256:0000"
+	stackscript, err = driver.uploadStackScriptFile()
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 2, stackscript.ID)
+	assert.Equal(t, "bootstrap-new", stackscript.Label)
+}
+
+func TestValidateStackScriptData(t *testing.T) {
+	script := &linodego.Stackscript{
+		ID:       1,
+		Username: "me",
+		Label:    "swarm",
+		Images:   []string{"linode/ubuntu22.04"},
+		UserDefinedFields: &[]linodego.StackscriptUDF{
+			{Name: "role", Label: "Swarm role", OneOf: "manager,worker"},
+			{Name: "features", Label: "Features", ManyOf: "a,b,c", Default: "a"},
+			{Name: "hostname", Label: "Hostname"},
+		},
+	}
+
+	assert.NoError(t, validateStackScriptData(script, map[string]string{
+		"role":     "worker",
+		"features": "a,c",
+		"hostname": "node",
+	}, "linode/ubuntu22.04"))
+
+	err := validateStackScriptData(script, map[string]string{
+		"role":     "leader",
+		"features": "a,d",
+		"hostnam":  "node",
+	}, "linode/debian12")
+	assert.EqualError(t, err, "StackScript 1 (me/swarm) data is invalid: "+
+		"image linode/debian12 is not supported (supported: linode/ubuntu22.04); "+
+		"unknown fields: hostnam; "+
+		"field role must be one of manager,worker; "+
+		"field features must be any of a,b,c; "+
+		"missing required field hostname (Hostname)")
+}
+
+func TestFindStackScript(t *testing.T) {
+	var filter string
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter = r.Header.Get("X-Filter")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": [
+			{"id": 1, "username": "linode", "label": "docker-host"},
+			{"id": 2, "username": "linode", "label": "docker"},
+			{"id": 3, "username": "other", "label": "docker"}
+		], "page": 1, "pages": 1, "results": 3}`))
+	}))
+
+	driver.StackScriptUser = "linode"
+	driver.StackScriptLabel = "docker"
+	driver.StackScriptPublic = "true"
+
+	script, err := driver.findStackScript()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, script.ID)
+	assert.JSONEq(t, `{"username": "linode", "label": "docker", "is_public": true}`, filter)
+
+	driver.StackScriptLabel = "missing"
+	_, err = driver.findStackScript()
+	assert.EqualError(t, err, "StackScript not found: linode/missing")
+}
+
+func TestNotFoundError(t *testing.T) {
+	regions := []string{"us-east", "us-central", "us-west", "eu-central", "ap-south"}
+
+	assert.EqualError(t, notFoundError("region", "us-eats", regions),
+		`linode region "us-eats" not found, did you mean us-east, us-west?`)
+	assert.EqualError(t, notFoundError("region", "mars-north", regions),
+		`linode region "mars-north" not found`)
+	assert.Equal(t, []string{"g6-standard-4"}, suggest("g6-standrd-4", []string{"g6-nanode-1", "g6-standard-4", "g6-standard-8"})[:1])
+}
+
+func TestSuffixLabel(t *testing.T) {
+	assert.Equal(t, "runner-a1b2c3", suffixLabel("runner", "a1b2c3"))
+
+	long := "mycoollabel25._-thislabelisreallygoodandlongwowthatscrazywhatago"
+	result := suffixLabel(long, "a1b2c3")
+	assert.Len(t, result, 64)
+	assert.Equal(t, "mycoollabel25._-thislabelisreallygoodandlongwowthatscrazy-a1b2c3", result)
+
+	trimmed := strings.Repeat("a", 56)
+	assert.Equal(t, trimmed+"-a1b2c3", suffixLabel(trimmed+"._bbbb", "a1b2c3"))
+}
+
+func TestSetConfigFromFlagsAdopt(t *testing.T) {
+	driver := NewDriver("", "")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"linode-token":       "PROJECT",
+			"linode-instance-id": 123,
+		},
+		CreateFlags: driver.GetCreateFlags(),
+	}
+
+	assert.Error(t, driver.SetConfigFromFlags(checkFlags))
+
+	checkFlags.FlagsValues["linode-root-pass"] = "ROOTPASS"
+	assert.NoError(t, driver.SetConfigFromFlags(checkFlags))
+	assert.True(t, driver.Adopted)
+	assert.Equal(t, 123, driver.InstanceID)
+}
+
+func TestRefreshIPAddresses(t *testing.T) {
+	driver := NewDriver("", "")
+	driver.IPAddress = "192.0.2.1"
+
+	linode := &linodego.Instance{IPv4: []*net.IP{
+		ptrIP("198.51.100.1"),
+		ptrIP("192.0.2.1"),
+		ptrIP("192.168.1.1"),
+	}}
+
+	driver.refreshIPAddresses(linode)
+	assert.Equal(t, "192.0.2.1", driver.IPAddress)
+	assert.Empty(t, driver.PrivateIPAddress)
+
+	driver.PrivateIPAddress = "192.168.2.2"
+	driver.refreshIPAddresses(linode)
+	assert.Equal(t, "192.0.2.1", driver.IPAddress)
+	assert.Equal(t, "192.168.1.1", driver.PrivateIPAddress)
+
+	linode.IPv4 = linode.IPv4[2:]
+	linode.IPv4 = append(linode.IPv4, ptrIP("203.0.113.1"))
+	driver.refreshIPAddresses(linode)
+	assert.Equal(t, "203.0.113.1", driver.IPAddress)
+}
+
+func TestGetIPRefresh(t *testing.T) {
+	var requests int
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 123, "status": "running", "ipv4": ["203.0.113.1"]}`))
+	}))
+
+	driver.InstanceID = 123
+	driver.IPAddress = "192.0.2.1"
+	driver.RefreshIP = true
+	for i := 0; i < 3; i++ {
+		ip, err := driver.GetIP()
+		assert.NoError(t, err)
+		assert.Equal(t, "203.0.113.1", ip)
+	}
+	assert.Equal(t, 1, requests)
+}
+
+func ptrIP(s string) *net.IP {
+	ip := net.ParseIP(s)
+	return &ip
+}
+
+func TestGetURLIPv6(t *testing.T) {
+	driver := NewDriver("", "")
+	driver.DockerPort = 2376
+	driver.setIPAddresses(&linodego.Instance{
+		IPv4: []*net.IP{ptrIP("192.0.2.1")},
+		IPv6: "2001:db8::f03c:91ff:fe24:3a2f/128",
+	}, false)
+
+	url, err := driver.GetURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://192.0.2.1:2376", url)
+
+	driver.UseIPv6 = true
+	url, err = driver.GetURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://[2001:db8::f03c:91ff:fe24:3a2f]:2376", url)
+
+	host, err := driver.GetSSHHostname()
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::f03c:91ff:fe24:3a2f", host)
+}
+
+func TestGetState(t *testing.T) {
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v4/linode/instances/123":
+			_, _ = w.Write([]byte(`{"id": 123, "status": "migrating", "ipv4": ["192.0.2.1"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Not found"}]}`))
+		}
+	}))
+
+	driver.InstanceID = 123
+	driver.IPAddress = "192.0.2.1"
+	s, err := driver.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Starting, s)
+	assert.Equal(t, "migrating", driver.InstanceStatus)
+
+	driver.InstanceID = 789
+	_, err = driver.GetState()
+	assert.EqualError(t, err, "Linode 789 no longer exists")
+}
+
+func TestInstanceAction(t *testing.T) {
+	var booted bool
+	eventStatus := linodego.EventFinished
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v4/linode/instances/123/boot":
+			booted = true
+			_, _ = w.Write([]byte("{}"))
+		case r.URL.Path == "/v4/account/events" && booted:
+			_, _ = w.Write([]byte(`{"page": 1, "pages": 1, "results": 1, "data": [
+				{"id": 1, "action": "linode_boot", "status": "started", "entity": {"id": 123, "type": "linode"}}
+			]}`))
+		case r.URL.Path == "/v4/account/events":
+			_, _ = w.Write([]byte(`{"page": 1, "pages": 1, "results": 0, "data": []}`))
+		case r.URL.Path == "/v4/account/events/1":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "action": "linode_boot", "status": eventStatus})
+		case r.URL.Path == "/v4/linode/instances/123":
+			_, _ = w.Write([]byte(`{"id": 123, "status": "running"}`))
+		case r.URL.Path == "/v4/account/maintenance":
+			assert.JSONEq(t, `{"entity.type": "linode", "entity.id": 123}`, r.Header.Get("X-Filter"))
+			_, _ = w.Write([]byte(`{"page": 1, "pages": 1, "results": 3, "data": [
+				{"entity": {"id": 123, "type": "linode"}, "type": "live_migration", "status": "scheduled"},
+				{"entity": {"id": 123, "type": "linode"}, "type": "reboot", "status": "completed"},
+				{"entity": {"id": 456, "type": "linode"}, "type": "reboot", "status": "scheduled"}
+			]}`))
+		}
+	}))
+
+	driver.InstanceID = 123
+	assert.NoError(t, driver.Start())
+	assert.Equal(t, "running", driver.InstanceStatus)
+	assert.Equal(t, []string{"live_migration scheduled"}, driver.PendingMaintenance)
+
+	booted = false
+	eventStatus = linodego.EventFailed
+	assert.EqualError(t, driver.Start(), "linode_boot of Linode 123 failed: event 1 has failed")
+}
+
+func TestKill(t *testing.T) {
+	var hung bool
+	var requests []string
+	status := linodego.InstanceRunning
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 123, "status": status})
+			return
+		}
+
+		action := path.Base(r.URL.Path)
+		requests = append(requests, action)
+		switch {
+		case action == "rescue":
+			// the mock assumes that Rescue Mode stops a hung guest; this
+			// tests the sequence of requests, not the Linode API behaviour
+			hung = false
+		case action == "shutdown" && !hung:
+			status = linodego.InstanceOffline
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	driver.InstanceID = 123
+	driver.KillGracePeriod = 1
+	assert.NoError(t, driver.Kill())
+	assert.Equal(t, []string{"shutdown"}, requests)
+	assert.Equal(t, linodego.InstanceOffline, status)
+
+	hung = true
+	requests = nil
+	status = linodego.InstanceRunning
+	assert.NoError(t, driver.Kill())
+	assert.Equal(t, []string{"shutdown", "rescue", "shutdown"}, requests)
+	assert.Equal(t, linodego.InstanceOffline, status)
+}
+
+func TestRetryTransientError(t *testing.T) {
+	response := func(method string, status int) *resty.Response {
+		return &resty.Response{
+			Request:     &resty.Request{Method: method},
+			RawResponse: &http.Response{StatusCode: status},
+		}
+	}
+
+	assert.True(t, retryTransientError(response(http.MethodGet, http.StatusBadGateway), nil))
+	assert.True(t, retryTransientError(response(http.MethodDelete, 0), errors.New("connection reset by peer")))
+	assert.False(t, retryTransientError(response(http.MethodGet, http.StatusNotFound), nil))
+	assert.False(t, retryTransientError(response(http.MethodGet, 0), context.Canceled))
+	assert.False(t, retryTransientError(response(http.MethodPost, http.StatusBadGateway), nil))
+	assert.False(t, retryTransientError(response(http.MethodPost, 0), errors.New("connection reset by peer")))
+}
+
+func TestCreateInstanceAfterError(t *testing.T) {
+	var created int
+	status := http.StatusGatewayTimeout
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			created++
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Unavailable"}]}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"page": 1, "pages": 1, "results": 1, "data": [
+			{"id": 123, "label": "machine", "region": "us-east", "type": "g6-standard-4"}
+		]}`))
+	}))
+
+	linode, err := driver.createInstance(linodego.InstanceCreateOptions{
+		Label:  "machine",
+		Region: "us-east",
+		Type:   "g6-standard-4",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 123, linode.ID)
+	assert.Equal(t, 1, created)
+
+	created = 0
+	driver.APIRetries = 1
+	_, err = driver.createInstance(linodego.InstanceCreateOptions{
+		Label:  "machine",
+		Region: "us-west",
+		Type:   "g6-standard-4",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 2, created)
+
+	// linodego must not repeat the request before the lookup by label
+	created = 0
+	status = http.StatusServiceUnavailable
+	linode, err = driver.createInstance(linodego.InstanceCreateOptions{
+		Label:  "machine",
+		Region: "us-east",
+		Type:   "g6-standard-4",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 123, linode.ID)
+	assert.Equal(t, 1, created)
+}
+
+func TestCreateInstanceDeadline(t *testing.T) {
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Gateway Timeout"}]}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"page": 1, "pages": 1, "results": 0, "data": []}`))
+	}))
+
+	// every attempt shares the single linode-api-timeout deadline
+	driver.APITimeout = 1
+	start := time.Now()
+	_, err := driver.createInstance(linodego.InstanceCreateOptions{Label: "machine"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestSetConfigFromFlagsAPIURL(t *testing.T) {
+	for _, tc := range []struct {
+		url, version         string
+		wantURL, wantVersion string
+		wantErr              bool
+	}{
+		{url: "http://localhost:8080", wantURL: "http://localhost:8080"},
+		{url: "https://api.linode.com/v4beta", wantURL: "https://api.linode.com", wantVersion: "v4beta"},
+		{url: "https://proxy.example.com/linode/v4/", version: "v4", wantURL: "https://proxy.example.com/linode", wantVersion: "v4"},
+		{url: "https://api.linode.com/v4beta", version: "v4", wantErr: true},
+		{url: "api.linode.com", wantURL: "https://api.linode.com"},
+		{url: "localhost:8080/v4beta", wantURL: "https://localhost:8080", wantVersion: "v4beta"},
+		{url: "https:///v4", wantErr: true},
+		{version: "v5", wantErr: true},
+	} {
+		driver := NewDriver("", "")
+		checkFlags := &drivers.CheckDriverOptions{
+			FlagsValues: map[string]interface{}{
+				"linode-token":       "TOKEN",
+				"linode-api-url":     tc.url,
+				"linode-api-version": tc.version,
+			},
+			CreateFlags: driver.GetCreateFlags(),
+		}
+
+		err := driver.SetConfigFromFlags(checkFlags)
+		if tc.wantErr {
+			assert.Error(t, err, tc.url)
+			continue
+		}
+
+		assert.NoError(t, err, tc.url)
+		assert.Equal(t, tc.wantURL, driver.APIURL)
+		assert.Equal(t, tc.wantVersion, driver.APIVersion)
+	}
+}
+
+func TestSetConfigFromFlagsTokenReference(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("FILE-TOKEN\n"), 0600))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".config"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".config", "linode-cli"), []byte(
+		"[default]\ntoken = DEFAULT-TOKEN\n\n[ci]\nregion = us-east\n\n[Prod]\ntoken = PROD-TOKEN\n",
+	), 0600))
+
+	for _, tc := range []struct {
+		flags     map[string]interface{}
+		wantToken string
+		wantErr   string
+	}{
+		{flags: map[string]interface{}{"linode-token-file": tokenFile}, wantToken: "FILE-TOKEN"},
+		{flags: map[string]interface{}{"linode-token": "ENV-TOKEN", "linode-profile": "prod"}, wantToken: "PROD-TOKEN"},
+		{flags: map[string]interface{}{"linode-profile": "ci"}, wantToken: "DEFAULT-TOKEN"},
+		{flags: map[string]interface{}{"linode-profile": "staging"}, wantErr: `linode-cli profile "staging" not found`},
+		{flags: map[string]interface{}{"linode-token-file": tokenFile, "linode-profile": "prod"}, wantErr: "cannot be used together"},
+		{flags: map[string]interface{}{}, wantErr: "requires the --linode-token"},
+	} {
+		driver := NewDriver("", "")
+		err := driver.SetConfigFromFlags(&drivers.CheckDriverOptions{
+			FlagsValues: tc.flags,
+			CreateFlags: driver.GetCreateFlags(),
+		})
+
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Empty(t, driver.APIToken)
+
+		token, err := driver.apiToken()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.wantToken, token)
+	}
+}
+
+func TestAPIRetries(t *testing.T) {
+	for _, retries := range []int{0, 3, -1} {
+		driver := NewDriver("", "")
+		checkFlags := &drivers.CheckDriverOptions{
+			FlagsValues: map[string]interface{}{
+				"linode-token":       "TOKEN",
+				"linode-api-retries": retries,
+			},
+			CreateFlags: driver.GetCreateFlags(),
+		}
+
+		err := driver.SetConfigFromFlags(checkFlags)
+		if retries < 0 {
+			assert.EqualError(t, err, "linode-api-retries must not be negative")
+			continue
+		}
+
+		assert.NoError(t, err)
+		b, err := json.Marshal(driver)
+		assert.NoError(t, err)
+
+		loaded := NewDriver("", "")
+		assert.NoError(t, json.Unmarshal(b, loaded))
+		assert.Equal(t, retries, loaded.APIRetries)
+	}
+
+	// machines stored before the field existed retry by default
+	loaded := NewDriver("", "")
+	assert.NoError(t, json.Unmarshal([]byte(`{"MachineName": "machine"}`), loaded))
+	assert.Equal(t, defaultAPIRetries, loaded.APIRetries)
+}
+
+func TestEncryptSecrets(t *testing.T) {
+	t.Setenv("LINODE_SECRETS_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+
+	driver := NewDriver("machine", "")
+	driver.EncryptSecrets = true
+	driver.APIToken = "TOKEN"
+	driver.RootPassword = "PASSWORD"
+	driver.Region = "us-east"
+
+	b, err := json.Marshal(driver)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "TOKEN")
+	assert.NotContains(t, string(b), "PASSWORD")
+	assert.Contains(t, string(b), `"Region":"us-east"`)
+
+	loaded := NewDriver("", "")
+	assert.NoError(t, json.Unmarshal(b, loaded))
+	assert.Equal(t, "TOKEN", loaded.APIToken)
+	assert.Equal(t, "PASSWORD", loaded.RootPassword)
+	assert.Equal(t, "machine", loaded.MachineName)
+
+	t.Setenv("LINODE_SECRETS_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", 32))))
+	assert.ErrorContains(t, json.Unmarshal(b, NewDriver("", "")), "wrong key")
+
+	t.Setenv("LINODE_SECRETS_KEY", "passphrase")
+	assert.ErrorContains(t, json.Unmarshal(b, NewDriver("", "")), "must be 32 random bytes")
+
+	t.Setenv("LINODE_SECRETS_KEY", "")
+	assert.ErrorContains(t, json.Unmarshal(b, NewDriver("", "")), "requires a key")
+}
+
+func TestMissingScopes(t *testing.T) {
+	required := []tokenScope{
+		{"linodes", scopeReadWrite},
+		{"events", scopeReadOnly},
+		{"stackscripts", scopeReadOnly},
+	}
+
+	assert.Empty(t, missingScopes("*", required))
+	assert.Empty(t, missingScopes("linodes:read_write events:read_write stackscripts:read_only", required))
+	assert.Empty(t, missingScopes("linodes:*,events:read_only,stackscripts:*", required))
+	assert.Equal(t, []string{"scope linodes:read_write", "scope stackscripts:read_only"},
+		missingScopes("linodes:read_only,events:read_only", required))
+}
+
+func TestCheckTokenScopes(t *testing.T) {
+	driver := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v4/profile/tokens":
+			_, _ = w.Write([]byte(`{"page": 1, "pages": 1, "results": 2, "data": [
+				{"id": 1, "token": "aaaaaaaaaaaaaaaa", "scopes": "*"},
+				{"id": 2, "token": "bbbbbbbbbbbbbbbb", "scopes": "linodes:read_only,events:read_only"},
+				{"id": 3, "token": "cccccccccccccccc", "scopes": "linodes:read_write"}
+			]}`))
+		case "/v4/profile":
+			_, _ = w.Write([]byte(`{"username": "ci", "restricted": true}`))
+		case "/v4/profile/grants":
+			_, _ = w.Write([]byte(`{"global": {"add_linodes": true}, "firewall": [{"id": 7, "permissions": "read_only"}]}`))
+		}
+	}))
+
+	driver.APIToken = "bbbbbbbbbbbbbbbb" + strings.Repeat("0", 48)
+	driver.FirewallID = 7
+	err := driver.checkTokenScopes()
+	assert.EqualError(t, err, "the Linode API token cannot create this machine, it is missing: "+
+		"scope linodes:read_write, scope firewall:read_write, read_write grant on firewall 7")
+
+	driver.APIToken = "aaaaaaaaaaaaaaaa" + strings.Repeat("0", 48)
+	driver.FirewallID = 0
+	assert.NoError(t, driver.checkTokenScopes())
+
+	// the events scope is only required to boot with a private IP
+	driver.APIToken = "cccccccccccccccc" + strings.Repeat("0", 48)
+	assert.NoError(t, driver.checkTokenScopes())
+
+	driver.CreatePrivateIP = true
+	assert.EqualError(t, driver.checkTokenScopes(), "the Linode API token cannot create this machine, it is missing: "+
+		"scope events:read_only")
+}